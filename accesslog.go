@@ -0,0 +1,119 @@
+package gos
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jiorry/libs/log"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessLog writes one line per request in the format of AccessLogFormat:
+//
+//	common    host - userid [time] "GET /path HTTP/1.1" status bytes
+//	combined  common + "referer" "user-agent" "route" duration_ms request_id
+//	json      {"time":..,"method":..,"path":..,"route":..,"status":..,...}
+type accessLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+func (a *App) openAccessLog() {
+	format := a.Config.AccessLogFormat
+	switch format {
+	case "common", "combined", "json":
+	case "", "off", "none":
+		return
+	default:
+		log.App.Alert("unknown access log format: " + format)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if a.Config.AccessLogFile != "" {
+		f, err := os.OpenFile(a.Config.AccessLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.App.Error("access log:", err)
+			return
+		}
+		w = f
+	}
+	a.accessLog = &accessLog{w: w, format: format}
+}
+
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	RequestId string  `json:"request_id"`
+	Remote    string  `json:"remote"`
+	UserId    int64   `json:"user_id"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Proto     string  `json:"proto"`
+	Handler   string  `json:"handler"`
+	Route     string  `json:"route"`
+	ApiMethod string  `json:"api_method,omitempty"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	Duration  float64 `json:"duration_ms"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+func (l *accessLog) write(info *requestInfo, req *http.Request, d time.Duration) {
+	remote, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remote = req.RemoteAddr
+	}
+	ms := float64(d.Nanoseconds()) / 1e6
+
+	var line []byte
+	if l.format == "json" {
+		line, _ = json.Marshal(&accessLogEntry{
+			Time:      info.Start.Format(time.RFC3339Nano),
+			RequestId: info.RequestId,
+			Remote:    remote,
+			UserId:    info.UserId,
+			Method:    req.Method,
+			Path:      req.URL.RequestURI(),
+			Proto:     req.Proto,
+			Handler:   info.Handler,
+			Route:     info.Route,
+			ApiMethod: info.ApiMethod,
+			Status:    info.Status,
+			Bytes:     info.Bytes,
+			Duration:  ms,
+			Referer:   req.Referer(),
+			UserAgent: req.UserAgent()})
+		line = append(line, '\n')
+	} else {
+		user := "-"
+		if info.UserId > 0 {
+			user = strconv.FormatInt(info.UserId, 10)
+		}
+		line = []byte(fmt.Sprintf("%s - %s [%s] %q %d %d",
+			remote, user, info.Start.Format("02/Jan/2006:15:04:05 -0700"),
+			req.Method+" "+req.URL.RequestURI()+" "+req.Proto, info.Status, info.Bytes))
+		if l.format == "combined" {
+			line = append(line, fmt.Sprintf(" %q %q %q %.3f %s",
+				orDash(req.Referer()), orDash(req.UserAgent()), orDash(info.Route), ms, info.RequestId)...)
+		}
+		line = append(line, '\n')
+	}
+
+	l.mu.Lock()
+	l.w.Write(line)
+	l.mu.Unlock()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
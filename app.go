@@ -0,0 +1,130 @@
+package gos
+
+import (
+	"github.com/jiorry/libs/log"
+	"io/fs"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// App owns its routes, config, middlewares and ServeMux, and implements
+// http.Handler, so several apps can run in one process, be mounted under
+// another mux, or be served by httptest.
+//
+//	shop := gos.NewApp()
+//	shop.AddRoute("/", (*ShopPage)(nil))
+//	http.Handle("/shop/", http.StripPrefix("/shop", shop))
+//
+// The package level functions (AddRoute, Use, Start ...) work on the default app.
+type App struct {
+	Config *HttpServer
+
+	routes      *routeTable
+	apiRoutes   *routeTable
+	upRoutes    *routeTable
+	wsRoutes    *routeTable
+	namedRoutes map[string]*Route
+	middlewares []Middleware
+	errorPages  map[int]reflect.Type
+	templates   *templateCache
+	fs          fs.FS
+	assets      *assetPipeline
+
+	pageStores   map[string]PageCacheStore
+	pageCacheKey func(ctx *Context) string
+	flightMu     sync.Mutex
+	flights      map[string]*pageFlight
+	uncached     map[string]bool // flight keys of the pages not shared
+
+	mux     *http.ServeMux
+	handler http.Handler
+	once    sync.Once
+
+	mu        sync.Mutex
+	servers   []*http.Server
+	listener  net.Listener
+	inflight  sync.WaitGroup
+	closing   chan bool // closed when Shutdown finishes
+	certs     *certLoader
+	metrics   *appMetrics
+	accessLog *accessLog
+}
+
+var defaultApp *App = NewApp()
+
+func NewApp() *App {
+	return &App{
+		Config:      newHttpServer(),
+		routes:      newRouteTable(),
+		apiRoutes:   newRouteTable(),
+		upRoutes:    newRouteTable(),
+		wsRoutes:    newRouteTable(),
+		namedRoutes: make(map[string]*Route),
+		errorPages:  make(map[int]reflect.Type),
+		templates:   newTemplateCache(),
+		pageStores:  make(map[string]PageCacheStore),
+		flights:     make(map[string]*pageFlight),
+		uncached:    make(map[string]bool),
+		middlewares: make([]Middleware, 0)}
+}
+
+// DefaultApp returns the app used by the package level functions.
+func DefaultApp() *App {
+	return defaultApp
+}
+
+// Handler returns the mux of the app wrapped by its middlewares.
+// The mux is built on the first call, routes and middlewares
+// should be added before.
+func (a *App) Handler() http.Handler {
+	a.once.Do(func() {
+		if a.Config.EnableMetrics {
+			a.metrics = newAppMetrics()
+		}
+		a.openAccessLog()
+		if a.runMode() != "dev" && (a.Config.AssetFingerprint || a.Config.AssetBundle) {
+			var err error
+			if a.assets, err = a.buildAssets(); err != nil {
+				log.App.Error("assets:", err)
+			}
+		}
+		a.mux = http.NewServeMux()
+		a.addHander()
+		a.handler = a.instrument(a.recover(a.applyMiddlewares(a.compress(a.mux))))
+	})
+	return a.handler
+}
+
+func (a *App) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	a.Handler().ServeHTTP(rw, req)
+}
+
+func (a *App) runMode() string {
+	if a.Config.RunMode != "" {
+		return a.Config.RunMode
+	}
+	return RunMode
+}
+
+func (a *App) homeUrl() string {
+	if a.Config.HomeUrl != "" {
+		return a.Config.HomeUrl
+	}
+	return HomeUrl
+}
+
+func (a *App) staticUrl() string {
+	if a.Config.StaticUrl != "" {
+		return a.Config.StaticUrl
+	}
+	return StaticUrl
+}
+
+func appOrDefault(a *App) *App {
+	if a == nil {
+		return defaultApp
+	}
+	return a
+}
@@ -0,0 +1,343 @@
+package gos
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/jiorry/libs/log"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const assetCacheControl = "public, max-age=31536000, immutable"
+
+// minifiers of the bundles by extension, see RegisterMinifier
+var minifiers = map[string]func([]byte) []byte{
+	".css": minifyCss,
+}
+
+// RegisterMinifier sets the minifier of the bundles with the extension, e.g.
+// RegisterMinifier(".js", jsmin.Minify). Only the css bundles have a
+// minifier by default: without a registered one, AssetMinify leaves the
+// js bundles as they are.
+func RegisterMinifier(ext string, f func([]byte) []byte) {
+	minifiers[ext] = f
+}
+
+type assetFile struct {
+	Path      string `json:"path"` // fingerprinted url path
+	Integrity string `json:"integrity"`
+	name      string // name in the app FS
+}
+
+type assetBundle struct {
+	path      string
+	integrity string
+	content   []byte
+	modified  time.Time
+}
+
+// assetPipeline maps the files of the assets folders to fingerprinted
+// names, /assets/css/site.css => /assets/css/site.1f2e3d4c5b.css,
+// and builds the bundles of the Page.Js and Page.Css lists.
+// It is built when the app starts out of dev mode with
+// AssetFingerprint or AssetBundle set.
+type assetPipeline struct {
+	app     *App
+	files   map[string]*assetFile // url path => file
+	origin  map[string]*assetFile // fingerprinted url path => file
+	mu      sync.RWMutex
+	bundles map[string]*assetBundle // url paths of the items => bundle
+	served  map[string]*assetBundle // bundle url path => bundle
+}
+
+// assetRef is a script or stylesheet tag to render.
+type assetRef struct {
+	url       string
+	integrity string
+	data      map[string]string
+}
+
+func (a *App) buildAssets() (*assetPipeline, error) {
+	p := &assetPipeline{
+		app:     a,
+		files:   make(map[string]*assetFile),
+		origin:  make(map[string]*assetFile),
+		bundles: make(map[string]*assetBundle),
+		served:  make(map[string]*assetBundle)}
+
+	fsys := a.FS()
+	for _, dir := range assetDirs(fsys) {
+		err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if name == dir && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// pre-compressed siblings are served with their file
+			for _, ext := range precompressedExt {
+				if strings.HasSuffix(name, ext) {
+					return nil
+				}
+			}
+
+			b, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			ext := path.Ext(name)
+			f := &assetFile{
+				Path:      "/" + strings.TrimSuffix(name, ext) + "." + contentHash(b) + ext,
+				Integrity: integrity(b),
+				name:      name}
+			p.files["/"+name] = f
+			p.origin[f.Path] = f
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// assetDirs returns the assets folder and the ones of the themes.
+func assetDirs(fsys fs.FS) []string {
+	dirs := []string{fsPath(AssetsName)}
+	if themes, err := fs.ReadDir(fsys, "themes"); err == nil {
+		for _, t := range themes {
+			if t.IsDir() {
+				dirs = append(dirs, "themes/"+t.Name()+"/"+fsPath(AssetsName))
+			}
+		}
+	}
+	return dirs
+}
+
+func contentHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:5])
+}
+
+// integrity returns the Subresource Integrity of the content.
+func integrity(b []byte) string {
+	sum := sha512.Sum384(b)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// assetPath returns the url path of the item without StaticUrl.
+func assetPath(item *ThemeItem) string {
+	p := item.GetAssetsPath()
+	if item.Folder == "" {
+		p = strings.Replace(p, "//", "/", 1)
+	}
+	return p
+}
+
+// assetUrl returns the fingerprinted url of the item, or its url with
+// the timestamp.
+func (a *App) assetUrl(item *ThemeItem) string {
+	if f := a.assets.file(assetPath(item)); f != nil {
+		return strings.TrimSuffix(a.staticUrl(), "/") + f.Path
+	}
+	return strings.TrimSuffix(a.staticUrl(), "/") + assetPath(item) + a.Config.Timestamp
+}
+
+// assetRefs returns the tags of the items, bundled in one when AssetBundle
+// is set and none of them has attributes.
+// The bundles are under /assets/bundle/, relative urls in the css files
+// should not go above the assets folder.
+func (a *App) assetRefs(items []*ThemeItem, ext string) []assetRef {
+	if a.assets != nil && a.Config.AssetBundle && len(items) > 1 {
+		if b := a.assets.bundle(items, ext); b != nil {
+			return []assetRef{{url: strings.TrimSuffix(a.staticUrl(), "/") + b.path, integrity: b.integrity}}
+		}
+	}
+
+	refs := make([]assetRef, len(items))
+	for i, item := range items {
+		refs[i] = assetRef{url: a.assetUrl(item), data: item.Data}
+		if f := a.assets.file(assetPath(item)); f != nil {
+			refs[i].integrity = f.Integrity
+		}
+	}
+	return refs
+}
+
+// file returns the fingerprinted file of the url path.
+func (p *assetPipeline) file(urlPath string) *assetFile {
+	if p == nil || !p.app.Config.AssetFingerprint {
+		return nil
+	}
+	return p.files[urlPath]
+}
+
+func (p *assetPipeline) bundle(items []*ThemeItem, ext string) *assetBundle {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		if item.Data != nil {
+			return nil
+		}
+		paths[i] = assetPath(item)
+	}
+	key := strings.Join(paths, ",")
+
+	p.mu.RLock()
+	b, ok := p.bundles[key]
+	p.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	fsys := p.app.FS()
+	var buf bytes.Buffer
+	for _, urlPath := range paths {
+		content, err := fs.ReadFile(fsys, fsPath(urlPath))
+		if err != nil {
+			log.App.Error("asset bundle:", err)
+			return nil
+		}
+		buf.Write(content)
+		if ext == ".js" {
+			buf.WriteString("\n;\n")
+		} else {
+			buf.WriteString("\n")
+		}
+	}
+
+	content := buf.Bytes()
+	if p.app.Config.AssetMinify {
+		if minify, ok := minifiers[ext]; ok {
+			content = minify(content)
+		}
+	}
+
+	b = &assetBundle{
+		path:      "/" + fsPath(AssetsName) + "/bundle/" + contentHash(content) + ext,
+		integrity: integrity(content),
+		content:   content,
+		modified:  time.Now()}
+
+	p.mu.Lock()
+	p.bundles[key] = b
+	p.served[b.path] = b
+	p.mu.Unlock()
+	return b
+}
+
+// serve serves the fingerprinted files and the bundles with a far-future
+// Cache-Control, it returns false for other paths.
+func (p *assetPipeline) serve(rw http.ResponseWriter, req *http.Request) bool {
+	if p == nil {
+		return false
+	}
+
+	if f, ok := p.origin[req.URL.Path]; ok {
+		rw.Header().Set("Cache-Control", assetCacheControl)
+		return p.app.serveFile(rw, req, f.name)
+	}
+
+	p.mu.RLock()
+	b, ok := p.served[req.URL.Path]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	rw.Header().Set("Cache-Control", assetCacheControl)
+	http.ServeContent(rw, req, b.path, b.modified, bytes.NewReader(b.content))
+	return true
+}
+
+// WriteAssets writes the fingerprinted copies of the assets and their
+// manifest.json into dir, to be uploaded to the StaticUrl host.
+func WriteAssets(dir string) error {
+	return defaultApp.WriteAssets(dir)
+}
+
+func (a *App) WriteAssets(dir string) error {
+	p := a.assets
+	if p == nil {
+		var err error
+		if p, err = a.buildAssets(); err != nil {
+			return err
+		}
+	}
+
+	fsys := a.FS()
+	manifest := make(map[string]*assetFile, len(p.files))
+	for urlPath, f := range p.files {
+		manifest[urlPath] = f
+		names := []string{f.name}
+		for _, ext := range precompressedExt {
+			names = append(names, f.name+ext)
+		}
+		for i, name := range names {
+			b, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				if i > 0 {
+					continue
+				}
+				return err
+			}
+			filename := filepath.Join(dir, filepath.FromSlash(f.Path+name[len(f.name):]))
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filename, b, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), b, 0644)
+}
+
+var (
+	// cssTokenReg matches the strings, kept as they are, and the comments
+	cssTokenReg = regexp.MustCompile(`(?s)"(?:\\.|[^"\\])*"|'(?:\\.|[^'\\])*'|/\*.*?\*/`)
+	cssSpaceReg = regexp.MustCompile(`\s+`)
+	cssPunctReg = regexp.MustCompile(`\s*([{};,])\s*`)
+)
+
+func minifyCss(b []byte) []byte {
+	var out, code []byte
+	last := 0
+	for _, loc := range cssTokenReg.FindAllIndex(b, -1) {
+		code = append(code, b[last:loc[0]]...)
+		last = loc[1]
+		if b[loc[0]] == '/' {
+			continue
+		}
+		out = append(out, minifyCssCode(code)...)
+		out = append(out, b[loc[0]:loc[1]]...)
+		code = code[:0]
+	}
+	code = append(code, b[last:]...)
+	out = append(out, minifyCssCode(code)...)
+	return bytes.TrimSpace(out)
+}
+
+// minifyCssCode minifies css without strings nor comments.
+func minifyCssCode(b []byte) []byte {
+	b = cssSpaceReg.ReplaceAll(b, []byte(" "))
+	b = cssPunctReg.ReplaceAll(b, []byte("$1"))
+	return bytes.ReplaceAll(b, []byte(";}"), []byte("}"))
+}
@@ -22,6 +22,7 @@ var separator []byte = []byte("|")
 type AuthVO struct {
 	Table, FieldId, FieldNick, FieldToken, FieldEmail, FieldSalt, FieldLastSee string
 	CookieKey, CookiePublicKey                                                 string
+	FieldGroup                                                                 string // user group of the page cache keys, see PageCacheKey
 }
 
 type RSAKey struct {
@@ -78,6 +79,9 @@ type UserAuth struct {
 
 func (this *UserAuth) SetContext(c *Context) *UserAuth {
 	this.ctx = c
+	if c != nil {
+		c.auth = this
+	}
 
 	if this.VO == nil {
 		this.VO = &AuthVO{}
@@ -97,6 +101,7 @@ func (this *UserAuth) SetContext(c *Context) *UserAuth {
 
 func (this *UserAuth) SetUser(row db.DataRow) *UserAuth {
 	this.user = row
+	this.trackUser()
 	return this
 }
 
@@ -115,7 +120,7 @@ func (this *UserAuth) Auth(ctype string, cipher []byte) (string, error) {
 	pwd := string(arr[1])
 
 	if time.Now().Unix()-int64(ts) > 30 {
-		return "", NewError(0, "user auth is overdue").Log("notice")
+		return "", this.ctx.NewError(0, "user auth is overdue").Log("notice")
 	}
 	var user db.DataRow
 	if ctype == "nick" {
@@ -125,16 +130,17 @@ func (this *UserAuth) Auth(ctype string, cipher []byte) (string, error) {
 	}
 
 	if user == nil {
-		return loginString, NewError(0, loginString+" not found").Log("notice")
+		return loginString, this.ctx.NewError(0, loginString+" not found").Log("notice")
 	}
 
 	if user.GetString(this.VO.FieldToken) != this.GenerateUserToken(user.GetString(this.VO.FieldNick), pwd, user.GetString(this.VO.FieldSalt)) {
 		this.ClearCookie()
 		this.user = nil
-		return loginString, NewError(0, "login failed").Log("notice")
+		return loginString, this.ctx.NewError(0, "login failed").Log("notice")
 	}
 
 	this.user = user
+	this.trackUser()
 
 	data := db.DataRow{}
 	data[this.VO.FieldLastSee] = time.Now()
@@ -247,10 +253,18 @@ func (this *UserAuth) CurrentUser() db.DataRow {
 	if this.user == nil || arr[2] != this.createAuthToken(login, ts, this.user.GetString(this.VO.FieldToken), privateSecret) {
 		this.user = nil
 	}
+	this.trackUser()
 
 	return this.user
 }
 
+// trackUser records the user id for the access log.
+func (this *UserAuth) trackUser() {
+	if len(this.user) > 0 && this.ctx != nil && this.ctx.Request != nil {
+		requestInfoOf(this.ctx.Request).UserId = this.user.GetInt64(this.VO.FieldId)
+	}
+}
+
 func (this *UserAuth) PraseCipher(cipher []byte) (int64, []byte, error) {
 	arr := bytes.Split(cipher, separator)
 	rsakeyUnix, _ := strconv.Atoi(string(arr[0]))
@@ -260,31 +274,31 @@ func (this *UserAuth) PraseCipher(cipher []byte) (int64, []byte, error) {
 
 	ppk := GetRSAKey(int64(rsakeyUnix))
 	if ppk == nil {
-		return 0, nil, NewError(0, "no rsa key found!").Log("error")
+		return 0, nil, this.ctx.NewError(0, "no rsa key found!").Log("error")
 	}
 
 	aeskeyBase64, err := rsa.DecryptPKCS1v15(rand.Reader, ppk.Key, rsaCipher)
 	if err != nil {
-		return 0, nil, NewError(0, "decrypt::", err).Log("error")
+		return 0, nil, this.ctx.NewError(0, "decrypt::", err).Log("error")
 	}
 
 	aeskey := make([]byte, 18)
 	base64.StdEncoding.Decode(aeskey, aeskeyBase64)
 	if len(aeskey) == 0 {
-		return 0, nil, NewError(0, "aeskey is empty").Log("error")
+		return 0, nil, this.ctx.NewError(0, "aeskey is empty").Log("error")
 	}
 	aeskey = aeskey[:16]
 
 	code, err := base64.StdEncoding.DecodeString(string(arr[2]))
 	if err != nil {
-		return 0, nil, NewError(0, "base64 decode:", err).Log("error")
+		return 0, nil, this.ctx.NewError(0, "base64 decode:", err).Log("error")
 	}
 
 	now := time.Now()
 	ts, _ := strconv.Atoi(fmt.Sprintf("%x", code[0:8]))
 
 	if now.Unix()-int64(ts/1000) > 30 {
-		return 0, nil, NewError(0, "login ts is exprie").Log("error")
+		return 0, nil, this.ctx.NewError(0, "login ts is exprie").Log("error")
 	}
 
 	b := crypto.AESDecrypt(code[8:24], aeskey[0:16], code[24:])
@@ -292,7 +306,7 @@ func (this *UserAuth) PraseCipher(cipher []byte) (int64, []byte, error) {
 	n := bytes.Index(b, []byte("-"))
 	l, err := strconv.Atoi(string(b[0:n]))
 	if err != nil {
-		return 0, nil, NewError(0, err).Log("error")
+		return 0, nil, this.ctx.NewError(0, err).Log("error")
 	}
 
 	return int64(ts), b[n+1 : n+1+l], nil
@@ -300,19 +314,19 @@ func (this *UserAuth) PraseCipher(cipher []byte) (int64, []byte, error) {
 
 func (this *UserAuth) Regist(login string, email string, cipher string) error {
 	if login == "" || email == "" {
-		return NewError(0, "login or email is empty")
+		return this.ctx.NewError(0, "login or email is empty")
 	}
 
 	e := (&db.ExistsBuilder{}).
 		Table(this.VO.Table).
 		Where(this.VO.FieldNick+"=? or "+this.VO.FieldEmail+"=?", login, email)
 	if isExist, _ := e.Exists(); isExist {
-		return NewError(0, "login or email exists")
+		return this.ctx.NewError(0, "login or email exists")
 	}
 
 	_, text, err := this.PraseCipher([]byte(cipher))
 	if err != nil {
-		return NewError(0, err)
+		return this.ctx.NewError(0, err)
 	}
 	salt := util.Unique()
 	err = this.RegistFunc(salt, this.GenerateUserToken(login, string(text), salt))
@@ -322,7 +336,7 @@ func (this *UserAuth) Regist(login string, email string, cipher string) error {
 
 	u := this.Query(login)
 	if u == nil {
-		return NewError(0, "user is empty")
+		return this.ctx.NewError(0, "user is empty")
 	} else {
 		this.SetUser(u)
 		this.SetCookie(0)
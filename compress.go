@@ -0,0 +1,317 @@
+package gos
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// content encodings in order of preference when the client accepts several
+// with the same quality.
+var encodingOrder = []string{"br", "gzip", "deflate"}
+
+var encoders = map[string]func(w io.Writer) io.WriteCloser{
+	"gzip": func(w io.Writer) io.WriteCloser {
+		gz := gzipPool.Get().(*gzip.Writer)
+		gz.Reset(w)
+		return &pooledGzip{gz}
+	},
+	"deflate": func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	},
+}
+
+var gzipPool = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+type pooledGzip struct {
+	*gzip.Writer
+}
+
+func (p *pooledGzip) Close() error {
+	err := p.Writer.Close()
+	gzipPool.Put(p.Writer)
+	return err
+}
+
+// compressible content types, matched by prefix
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/x-javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+// RegisterEncoder adds a response encoder, e.g. brotli:
+//
+//	gos.RegisterEncoder("br", func(w io.Writer) io.WriteCloser {
+//		return brotli.NewWriter(w)
+//	})
+func RegisterEncoder(name string, f func(w io.Writer) io.WriteCloser) {
+	encoders[name] = f
+	for _, n := range encodingOrder {
+		if n == name {
+			return
+		}
+	}
+	encodingOrder = append([]string{name}, encodingOrder...)
+}
+
+// acceptEncodings returns the encodings accepted by the request,
+// best first.
+func acceptEncodings(req *http.Request) []string {
+	header := req.Header.Get("Accept-Encoding")
+	if header == "" {
+		return nil
+	}
+
+	q := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, quality := strings.TrimSpace(part), 1.0
+		if i := strings.Index(name, ";"); i != -1 {
+			param := strings.TrimSpace(name[i+1:])
+			name = strings.TrimSpace(name[:i])
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = v
+				}
+			}
+		}
+		q[strings.ToLower(name)] = quality
+	}
+
+	result := make([]string, 0, len(encodingOrder))
+	quality := make(map[string]float64, len(encodingOrder))
+	for _, name := range encodingOrder {
+		v, ok := q[name]
+		if !ok {
+			v, ok = q["*"]
+		}
+		if !ok || v <= 0 {
+			continue
+		}
+		quality[name] = v
+		// keep the order of preference among equal qualities
+		i := len(result)
+		for i > 0 && quality[result[i-1]] < v {
+			i--
+		}
+		result = append(result, "")
+		copy(result[i+1:], result[i:])
+		result[i] = name
+	}
+	return result
+}
+
+func isCompressible(ctype string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// compress wraps h with response compression when EnableGzip is set.
+func (a *App) compress(h http.Handler) http.Handler {
+	if !a.Config.EnableGzip {
+		return h
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == "HEAD" || strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		var accepted []string
+		for _, name := range acceptEncodings(req) {
+			if _, ok := encoders[name]; ok {
+				accepted = append(accepted, name)
+			}
+		}
+		if len(accepted) == 0 {
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: rw, encoding: accepted[0], minSize: a.Config.CompressMinSize}
+		// not deferred, a panicking handler must not flush a partial response
+		h.ServeHTTP(cw, req)
+		cw.Close()
+	})
+}
+
+// compressWriter buffers the first minSize bytes to decide
+// whether the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	status  int
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = code
+	if code < 200 || code == 204 || code == 206 || code == 304 {
+		w.decide(true)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.minSize {
+			if err := w.decide(false); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide writes the header and the buffered data, compressed or not.
+// final is true when no more data will be written.
+func (w *compressWriter) decide(final bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = 200
+	}
+
+	header := w.Header()
+	ctype := header.Get("Content-Type")
+	if ctype == "" && len(w.buf) > 0 {
+		ctype = http.DetectContentType(w.buf)
+		header.Set("Content-Type", ctype)
+	}
+
+	compressible := isCompressible(ctype) && header.Get("Content-Encoding") == ""
+	if compressible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	hasBody := w.status >= 200 && w.status != 204 && w.status != 206 && w.status != 304
+	if compressible && hasBody && !(final && len(w.buf) < w.minSize) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		// the compressed body is not byte for byte the tagged one
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		header.Del("Accept-Ranges")
+		w.ResponseWriter.WriteHeader(w.status)
+		w.enc = encoders[w.encoding](w.ResponseWriter)
+		_, err := w.enc.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	var err error
+	if len(w.buf) > 0 {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// nothing written by the handler
+			return nil
+		}
+		w.decide(true)
+	}
+	if w.enc != nil {
+		return w.enc.Close()
+	}
+	return nil
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack is not supported")
+}
+
+// pre-compressed file suffixes for the content encodings
+var precompressedExt = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// serveFile serves a file of the app FS, or its pre-compressed sibling
+// (file.br, file.gz) when compression is on and the client accepts it.
+// It returns false when the file is not found.
+func (a *App) serveFile(rw http.ResponseWriter, req *http.Request, name string) bool {
+	fsys := a.FS()
+	if a.Config.EnableGzip {
+		for _, enc := range acceptEncodings(req) {
+			ext, ok := precompressedExt[enc]
+			if !ok {
+				continue
+			}
+			f, info, ok := openFile(fsys, name+ext)
+			if !ok {
+				continue
+			}
+			defer f.Close()
+
+			header := rw.Header()
+			if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+				header.Set("Content-Type", ctype)
+			}
+			header.Set("Content-Encoding", enc)
+			header.Add("Vary", "Accept-Encoding")
+			serveContent(rw, req, name, info, f)
+			return true
+		}
+	}
+
+	f, info, ok := openFile(fsys, name)
+	if !ok {
+		return false
+	}
+	defer f.Close()
+	serveContent(rw, req, name, info, f)
+	return true
+}
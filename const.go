@@ -6,6 +6,20 @@ const (
 	CACHE_DISABLED  int = -1
 )
 
+var (
+	httpMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+	// page hook called for each request method
+	methodHooks = map[string]string{
+		"GET":    "Get",
+		"HEAD":   "Get",
+		"POST":   "Post",
+		"PUT":    "Put",
+		"PATCH":  "Patch",
+		"DELETE": "Delete",
+	}
+)
+
 var (
 	RenderNothing = &EmptyRender{}
 
@@ -13,13 +13,61 @@ type Context struct {
 	ResponseWriter http.ResponseWriter
 	routerParams   map[string]string
 	Request        *http.Request
+	app            *App
+	err            *MyError
+	auth           *UserAuth
+	csrf           string
+	flight         *pageFlight // the page cache miss rendered by this request
+	noCache        bool        // the response is bound to the request, see CachePage
+}
+
+// RequestId returns the X-Request-ID of the request.
+func (ctx *Context) RequestId() string {
+	if ctx == nil || ctx.Request == nil {
+		return ""
+	}
+	return requestInfoOf(ctx.Request).RequestId
+}
+
+// NewError creates a MyError logged with the request id.
+func (ctx *Context) NewError(code int, messages ...interface{}) *MyError {
+	err := NewError(code, messages...)
+	err.RequestId = ctx.RequestId()
+	return err
+}
+
+// HttpError returns the error rendered by an error page, see SetErrorPage.
+func (ctx *Context) HttpError() *MyError {
+	return ctx.err
+}
+
+// userAuth returns the UserAuth of the page, or a default one.
+func (ctx *Context) userAuth() *UserAuth {
+	if ctx.auth == nil {
+		(&UserAuth{}).SetContext(ctx)
+	}
+	return ctx.auth
+}
+
+// App returns the app serving the request.
+func (ctx *Context) App() *App {
+	if ctx == nil || ctx.app == nil {
+		return defaultApp
+	}
+	return ctx.app
 }
 
 func (ctx *Context) WriteString(content string) {
 	ctx.ResponseWriter.Write([]byte(content))
 }
 
+// Exit writes the response. Error codes are rendered by the error page
+// registered for them, see SetErrorPage.
 func (ctx *Context) Exit(code int, body string) {
+	if code >= 400 {
+		ctx.App().serveError(ctx.ResponseWriter, ctx.Request, code, body)
+		return
+	}
 	ctx.ResponseWriter.WriteHeader(code)
 	ctx.ResponseWriter.Write([]byte(body))
 }
@@ -36,8 +84,7 @@ func (ctx *Context) NotModified() {
 }
 
 func (ctx *Context) NotFound(message string) {
-	ctx.ResponseWriter.WriteHeader(404)
-	ctx.ResponseWriter.Write([]byte(message))
+	ctx.App().serveError(ctx.ResponseWriter, ctx.Request, 404, message)
 }
 
 func (ctx *Context) ContentType(ext string) {
@@ -0,0 +1,57 @@
+package gos
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+var (
+	CSRFCookie = "gos_csrf"
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRFToken returns the CSRF token of the client, a new one is set in
+// the cookie when the client has none. The page is not cached.
+func (ctx *Context) CSRFToken() string {
+	ctx.noCache = true
+	if ctx.csrf != "" {
+		return ctx.csrf
+	}
+	if c, err := ctx.Request.Cookie(CSRFCookie); err == nil && len(c.Value) >= 32 {
+		ctx.csrf = c.Value
+		return ctx.csrf
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	ctx.csrf = base64.RawURLEncoding.EncodeToString(b)
+	ctx.SetCookie(CSRFCookie, ctx.csrf, 0, "/", "", true)
+	return ctx.csrf
+}
+
+// CheckCSRF is a route filter rejecting the unsafe requests whose form
+// field csrf_token or X-CSRF-Token header does not match the cookie:
+//
+//	gos.AddRoute("/account", (*AccountPage)(nil)).Before(gos.CheckCSRF)
+func CheckCSRF(ctx *Context) bool {
+	switch ctx.Request.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+
+	c, err := ctx.Request.Cookie(CSRFCookie)
+	if err == nil && c.Value != "" {
+		token := ctx.Request.Header.Get(CSRFHeader)
+		if token == "" {
+			token = ctx.Request.FormValue(CSRFField)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.Value)) == 1 {
+			return true
+		}
+	}
+
+	ctx.Exit(403, "Invalid CSRF Token")
+	return false
+}
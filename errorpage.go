@@ -0,0 +1,77 @@
+package gos
+
+import (
+	"encoding/json"
+	"github.com/jiorry/libs/log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// SetErrorPage renders the responses with the status code by the page,
+// e.g. SetErrorPage(404, (*NotFoundPage)(nil)).
+// The page runs Init, Get and Action and is rendered with its layout like
+// the routed pages; Context.HttpError returns the error.
+// Requests under /api/ get a JSON error instead.
+func SetErrorPage(code int, clas interface{}) {
+	defaultApp.SetErrorPage(code, clas)
+}
+
+func (a *App) SetErrorPage(code int, clas interface{}) {
+	typ := reflect.TypeOf(clas)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	a.errorPages[code] = typ
+}
+
+// serveError writes the error response for code.
+func (a *App) serveError(rw http.ResponseWriter, req *http.Request, code int, message string) {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	err := NewError(code, message)
+	err.RequestId = requestInfoOf(req).RequestId
+
+	if strings.HasPrefix(req.URL.Path, "/api/") {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(code)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"code": code, "message": message, "iserror": true})
+		return
+	}
+
+	typ, ok := a.errorPages[code]
+	if !ok || !a.renderErrorPage(rw, req, typ, err) {
+		http.Error(rw, message, code)
+	}
+}
+
+// renderErrorPage returns false when nothing is written,
+// the page panicked before starting the response.
+func (a *App) renderErrorPage(rw http.ResponseWriter, req *http.Request, typ reflect.Type, err *MyError) (written bool) {
+	sw := &statusWriter{ResponseWriter: rw}
+	defer func() {
+		if e := recover(); e != nil {
+			log.App.Error("rid="+err.RequestId, "error page", typ.String(), "panic:", e)
+			written = sw.status != 0
+		}
+	}()
+
+	ctx := a.buildContext(sw, req, &RouteMatched{ClassType: typ})
+	ctx.err = err
+
+	prt := reflect.New(typ)
+	prt.MethodByName("SetView").Call([]reflect.Value{reflect.ValueOf(typ.Name())})
+	prt.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ctx), prt})
+
+	if isDie(prt.MethodByName("Init").Call(nil)) ||
+		isDie(prt.MethodByName("Get").Call(nil)) ||
+		isDie(prt.MethodByName("Action").Call(nil)) {
+		// a hook stopping without a response gets the plain error
+		return sw.status != 0
+	}
+
+	sw.WriteHeader(err.Code)
+	prt.MethodByName("RenderPage").Call(nil)
+	return true
+}
@@ -0,0 +1,203 @@
+package gos
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jiorry/libs/log"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// StaticParams enumerates the parameters of the pages Export renders
+// for a route with parameters, one map per page:
+//
+//	gos.AddRoute("/product/:id<int>", (*ProductPage)(nil)).StaticParams(func() []map[string]string {
+//		return []map[string]string{{"id": "1"}, {"id": "2"}}
+//	})
+func (r *Route) StaticParams(f func() []map[string]string) *Route {
+	r.staticParams = f
+	return r
+}
+
+// Export renders the page routes by GET requests through the whole app,
+// filters and middlewares included, and writes the pages with the assets
+// into dir, ready to be uploaded to a CDN. /about is written to
+// dir/about/index.html. The routes with parameters are exported only
+// when they have StaticParams.
+func Export(dir string) error {
+	return defaultApp.Export(dir)
+}
+
+func (a *App) Export(dir string) error {
+	h := a.Handler()
+	paths, failed := a.exportPaths()
+	for _, p := range paths {
+		if err := a.exportPage(h, dir, p); err != nil {
+			log.App.Error("export", p, err)
+			failed++
+		}
+	}
+
+	// after the pages, the bundles are built when they are rendered
+	if err := a.exportAssets(dir); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("export: %d pages failed", failed)
+	}
+	return nil
+}
+
+// exportPaths returns the url paths of the pages to export,
+// failed counts the StaticParams which do not fit their route.
+func (a *App) exportPaths() (paths []string, failed int) {
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, r := range a.routes.list {
+		if !r.IsAllowed("GET") {
+			continue
+		}
+		if len(r.Keys) == 0 {
+			add(string(r.Rule))
+			continue
+		}
+		if r.staticParams == nil {
+			log.App.Info("export: skip", string(r.Rule), "without StaticParams")
+			continue
+		}
+
+		for _, params := range r.staticParams() {
+			args := make([]interface{}, 0, len(params)*2)
+			for _, k := range r.Keys {
+				if v, ok := params[k]; ok {
+					args = append(args, k, v)
+				}
+			}
+			p, err := r.path(string(r.Rule), args)
+			if err != nil {
+				log.App.Error("export:", err)
+				failed++
+				continue
+			}
+			add(p)
+		}
+	}
+	return paths, failed
+}
+
+func (a *App) exportPage(h http.Handler, dir, urlPath string) error {
+	rw := &exportWriter{header: make(http.Header)}
+	h.ServeHTTP(rw, a.exportRequest(urlPath))
+	if rw.status != 0 && rw.status != 200 {
+		return fmt.Errorf("status %d", rw.status)
+	}
+
+	name := fsPath(urlPath)
+	if name == "." {
+		name = "index.html"
+	} else if path.Ext(name) == "" {
+		name += "/index.html"
+	}
+	return writeExportFile(dir, name, rw.body.Bytes())
+}
+
+// exportAssets writes the fingerprinted assets and the bundles when the
+// asset pipeline is on, the asset folders as they are otherwise.
+func (a *App) exportAssets(dir string) error {
+	p := a.assets
+	if p != nil && a.Config.AssetFingerprint {
+		if err := a.WriteAssets(dir); err != nil {
+			return err
+		}
+	} else {
+		fsys := a.FS()
+		for _, root := range assetDirs(fsys) {
+			err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					if name == root && os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if d.IsDir() {
+					return nil
+				}
+				b, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					return err
+				}
+				return writeExportFile(dir, name, b)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, b := range p.served {
+		if err := writeExportFile(dir, fsPath(b.path), b.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeExportFile(dir, name string, b []byte) error {
+	filename := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, b)
+}
+
+// exportRequest is the synthetic GET request of a page, for the host of HomeUrl.
+func (a *App) exportRequest(urlPath string) *http.Request {
+	req, err := http.NewRequest("GET", urlPath, nil)
+	if err != nil {
+		req, _ = http.NewRequest("GET", "/", nil)
+	}
+	if u, err := url.Parse(a.homeUrl()); err == nil && u.Host != "" {
+		req.Host = u.Host
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	return req
+}
+
+// exportWriter keeps the response of an exported page.
+type exportWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *exportWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *exportWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *exportWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = 200
+	}
+	return w.body.Write(b)
+}
@@ -0,0 +1,120 @@
+package gos
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SetFS serves the templates, themes and static files from fsys instead
+// of WebRoot, e.g. files embedded in the binary:
+//
+//	//go:embed webroot
+//	var files embed.FS
+//
+//	root, _ := fs.Sub(files, "webroot")
+//	gos.SetFS(root)
+//
+// In dev mode the files of WebRoot are preferred so they can be edited live.
+func SetFS(fsys fs.FS) {
+	defaultApp.SetFS(fsys)
+}
+
+func (a *App) SetFS(fsys fs.FS) {
+	a.fs = fsys
+}
+
+// FS returns the files of the app.
+func (a *App) FS() fs.FS {
+	disk := os.DirFS(a.Config.WebRoot)
+	if a.fs == nil {
+		return disk
+	}
+	if a.runMode() == "dev" {
+		return &overlayFS{disk, a.fs}
+	}
+	return a.fs
+}
+
+// fsPath returns the name in the FS of an url path, /css/site.css => css/site.css
+func fsPath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// overlayFS opens the files of upper, or of lower when upper has none.
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return o.lower.Open(name)
+}
+
+func (o *overlayFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fs.Stat(o.upper, name)
+	if err == nil {
+		return info, nil
+	}
+	return fs.Stat(o.lower, name)
+}
+
+// ReadDir merges the entries of both.
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, uerr := fs.ReadDir(o.upper, name)
+	lower, lerr := fs.ReadDir(o.lower, name)
+	if uerr != nil && lerr != nil {
+		return nil, uerr
+	}
+
+	seen := make(map[string]bool, len(upper))
+	for _, e := range upper {
+		seen[e.Name()] = true
+	}
+	for _, e := range lower {
+		if !seen[e.Name()] {
+			upper = append(upper, e)
+		}
+	}
+	sort.Slice(upper, func(i, j int) bool { return upper[i].Name() < upper[j].Name() })
+	return upper, nil
+}
+
+// openFile opens a regular file of fsys.
+func openFile(fsys fs.FS, name string) (fs.File, fs.FileInfo, bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, nil, false
+	}
+	return f, info, true
+}
+
+func serveContent(rw http.ResponseWriter, req *http.Request, name string, info fs.FileInfo, f fs.File) {
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(rw, err.Error(), 500)
+			return
+		}
+		rs = bytes.NewReader(b)
+	}
+	http.ServeContent(rw, req, name, info.ModTime(), rs)
+}
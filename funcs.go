@@ -0,0 +1,178 @@
+package gos
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateFuncs are available in TemplateRender and TextRender templates.
+//
+//	{{url "product.show" "id" .Id}}       url of a named route, see URLFor
+//	{{asset "css/site.css"}}              url of an asset, {{asset "css/site.css" "blue"}} for a theme
+//	{{date .CreatedAt "2006-01-02"}}      formats time.Time or unix seconds
+//	{{number .Price 2}}                   1234.5 => 1,234.50
+//	{{json .}}                            encodes the value for a script
+//	{{csrf_field}}                        hidden input with the CSRF token, see CheckCSRF
+//	{{current_user}}                      the logged user row, nil for guests
+//	                                      (a page using csrf_field or current_user is not cached)
+//	{{safe_html .Body}}                   trusted content, also safe_attr, safe_js, safe_css and safe_url
+var templateFuncs = template.FuncMap{
+	"url":          URLFor,
+	"asset":        defaultApp.asset,
+	"date":         formatDate,
+	"number":       formatNumber,
+	"json":         toJson,
+	"csrf_field":   func() template.HTML { return "" },
+	"current_user": func() interface{} { return nil },
+	"safe_html":    func(s string) template.HTML { return template.HTML(s) },
+	"safe_attr":    func(s string) template.HTMLAttr { return template.HTMLAttr(s) },
+	"safe_js":      func(s string) template.JS { return template.JS(s) },
+	"safe_css":     func(s string) template.CSS { return template.CSS(s) },
+	"safe_url":     func(s string) template.URL { return template.URL(s) },
+}
+
+// AddFuncMap adds functions to the templates, e.g. a translation:
+//
+//	gos.AddFuncMap(template.FuncMap{"t": i18n.Translate})
+//
+// It must be called before the templates are rendered.
+func AddFuncMap(funcs template.FuncMap) {
+	for k, f := range funcs {
+		templateFuncs[k] = f
+	}
+}
+
+// appFuncs are the functions bound to the app.
+func (a *App) appFuncs() template.FuncMap {
+	return template.FuncMap{
+		"url":   a.URLFor,
+		"asset": a.asset,
+	}
+}
+
+// funcs are templateFuncs with the functions bound to the app.
+func (a *App) funcs() map[string]interface{} {
+	funcs := make(map[string]interface{}, len(templateFuncs)+2)
+	for k, f := range templateFuncs {
+		funcs[k] = f
+	}
+	for k, f := range a.appFuncs() {
+		funcs[k] = f
+	}
+	return funcs
+}
+
+// requestFuncs are the functions bound to the request.
+func requestFuncs(ctx *Context) map[string]interface{} {
+	return map[string]interface{}{
+		"csrf_field": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + CSRFField + `" value="` + template.HTMLEscapeString(ctx.CSRFToken()) + `">`)
+		},
+		"current_user": func() interface{} {
+			ctx.noCache = true
+			user := ctx.userAuth().CurrentUser()
+			if len(user) == 0 {
+				return nil
+			}
+			return user
+		},
+	}
+}
+
+func (a *App) asset(name string, theme ...string) string {
+	item := &ThemeItem{Value: name}
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		item.Folder, item.Value = name[:i], name[i+1:]
+	}
+	if len(theme) > 0 {
+		item.Theme = theme[0]
+	}
+	return a.assetUrl(item)
+}
+
+func formatDate(v interface{}, layout ...string) string {
+	var t time.Time
+	switch d := v.(type) {
+	case time.Time:
+		t = d
+	case *time.Time:
+		if d == nil {
+			return ""
+		}
+		t = *d
+	case int64:
+		t = time.Unix(d, 0)
+	case int:
+		t = time.Unix(int64(d), 0)
+	default:
+		return fmt.Sprint(v)
+	}
+	if t.IsZero() {
+		return ""
+	}
+	if len(layout) > 0 {
+		return t.Format(layout[0])
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func formatNumber(v interface{}, decimals ...int) string {
+	var f float64
+	switch n := v.(type) {
+	case int:
+		f = float64(n)
+	case int32:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case uint:
+		f = float64(n)
+	case uint32:
+		f = float64(n)
+	case uint64:
+		f = float64(n)
+	case float32:
+		f = float64(n)
+	case float64:
+		f = n
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(n, 64); err != nil {
+			return n
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+
+	dec := 0
+	if len(decimals) > 0 {
+		dec = decimals[0]
+	}
+	s := strconv.FormatFloat(f, 'f', dec, 64)
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i != -1 {
+		intPart, fracPart = s[:i], s[i:]
+	}
+	for i := len(intPart) - 3; i > 0; i -= 3 {
+		intPart = intPart[:i] + "," + intPart[i:]
+	}
+	return sign + intPart + fracPart
+}
+
+func toJson(v interface{}) (template.JS, error) {
+	b, err := json.Marshal(v)
+	return template.JS(b), err
+}
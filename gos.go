@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/jiorry/db"
-	"github.com/jiorry/gos/websock"
 	"github.com/jiorry/libs/cache"
 	"github.com/jiorry/libs/conf"
 	"github.com/jiorry/libs/log"
@@ -16,29 +15,78 @@ import (
 	"net/http/fcgi"
 	"os"
 	"reflect"
+	"strings"
+	"time"
 )
 
 type HttpServer struct {
 	Addr       string
 	Port       int
 	EnableGzip bool
-	PprofOn    bool
-	GlobalData db.DataRow
+	// responses smaller than this are not compressed
+	CompressMinSize int
+	PprofOn         bool
+	// pprof is mounted at PprofPath, or served on its own listener PprofAddr.
+	// PprofAllow lists the allowed ips or CIDRs, and PprofUser/PprofPassword
+	// the basic auth credential. One of them is required at PprofPath, on
+	// PprofAddr only loopback is allowed without them.
+	PprofPath     string
+	PprofAddr     string
+	PprofAllow    []string
+	PprofUser     string
+	PprofPassword string
+	GlobalData    db.DataRow
 
 	WebRoot   string
 	Timestamp string
+	// out of dev mode, the assets are served with fingerprinted names and
+	// the Page.Js and Page.Css lists are bundled, see assetPipeline.
+	// AssetMinify minifies the css bundles, the js bundles only with a
+	// minifier set by RegisterMinifier(".js", ...)
+	AssetFingerprint bool
+	AssetBundle      bool
+	AssetMinify      bool
 
 	EnablePing      bool
+	EnableMetrics   bool
+	MetricsPath     string
 	EnableUpload    bool
 	EnableApi       bool
 	EnableWebSocket bool
 
 	UseFcgi   bool
 	lenStatic int
+
+	// PageCacheSize is the number of pages of the memory page cache,
+	// the file page cache is in PageCacheDir
+	PageCacheSize int
+	PageCacheDir  string
+
+	// common, combined, json or off. The access log is written to
+	// AccessLogFile, or stdout when it is empty.
+	AccessLogFormat string
+	AccessLogFile   string
+
+	// time given to in-flight requests on SIGINT/SIGTERM
+	ShutdownTimeout time.Duration
+
+	// https is served on HttpsPort when TLSCert and TLSKey are set
+	TLSCert       string
+	TLSKey        string
+	HttpsPort     int
+	HttpsRedirect bool
+	// Strict-Transport-Security max-age in seconds, 0 for no header
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+
+	// the run mode and urls of the app, the package level RunMode,
+	// HomeUrl and StaticUrl set by Init are used when they are empty
+	RunMode   string
+	HomeUrl   string
+	StaticUrl string
 }
 
 var (
-	httpServer *HttpServer
 	HomeUrl    string
 	StaticUrl  string
 	AssetsName string
@@ -46,20 +94,31 @@ var (
 	RunMode    string //"dev" or "prod"
 )
 
-func init() {
-	httpServer = &HttpServer{
+func newHttpServer() *HttpServer {
+	return &HttpServer{
 		Addr:            "",
 		Port:            8080,
 		WebRoot:         "webroot",
 		PprofOn:         false,
+		PprofPath:       "/debug/pprof",
 		EnableGzip:      false,
+		CompressMinSize: 1024,
 		EnablePing:      false,
+		EnableMetrics:   false,
+		MetricsPath:     "/metrics",
 		EnableUpload:    false,
 		EnableApi:       false,
 		EnableWebSocket: false,
 		UseFcgi:         false,
+		AccessLogFile:   "var/log/access.log",
+		PageCacheSize:   1000,
+		PageCacheDir:    "var/cache",
+		ShutdownTimeout: 30 * time.Second,
+		HttpsPort:       443,
 	}
+}
 
+func init() {
 	HomeUrl = "/"
 	StaticUrl = "/"
 	AssetsName = "assets"
@@ -103,7 +162,11 @@ func Init() {
 	if appConf.IsSet("assets") {
 		AssetsName = appConf.GetString("assets")
 	}
+	if appConf.IsSet("view_engine") {
+		DefaultViewEngine = appConf.GetString("view_engine")
+	}
 
+	httpServer := defaultApp.Config
 	if httpConf.IsSet("webroot") {
 		httpServer.WebRoot = httpConf.GetString("webroot")
 	}
@@ -111,6 +174,15 @@ func Init() {
 	if httpConf.IsSet("timestamp") {
 		httpServer.Timestamp = "?ts=" + httpConf.GetString("timestamp")
 	}
+	httpServer.AssetFingerprint = httpConf.GetBool("asset_fingerprint")
+	httpServer.AssetBundle = httpConf.GetBool("asset_bundle")
+	httpServer.AssetMinify = httpConf.GetBool("asset_minify")
+	if httpConf.IsSet("page_cache_size") {
+		httpServer.PageCacheSize = httpConf.GetInt("page_cache_size")
+	}
+	if httpConf.IsSet("page_cache_dir") {
+		httpServer.PageCacheDir = httpConf.GetString("page_cache_dir")
+	}
 
 	if RunMode == "dev" {
 		log.Level = 10
@@ -128,10 +200,45 @@ func Init() {
 		httpServer.Port = httpConf.GetInt("port")
 	}
 
+	httpServer.EnableMetrics = httpConf.GetBool("metrics")
+	if httpConf.IsSet("metrics_path") {
+		httpServer.MetricsPath = httpConf.GetString("metrics_path")
+	}
+
 	httpServer.UseFcgi = httpConf.GetBool("fcgi")
 	httpServer.lenStatic = len(httpServer.WebRoot)
 	httpServer.PprofOn = httpConf.GetBool("pprof")
+	if httpConf.IsSet("pprof_path") {
+		httpServer.PprofPath = httpConf.GetString("pprof_path")
+	}
+	httpServer.PprofAddr = httpConf.GetString("pprof_addr")
+	if httpConf.IsSet("pprof_allow") {
+		httpServer.PprofAllow = strings.Split(httpConf.GetString("pprof_allow"), ",")
+	}
+	httpServer.PprofUser = httpConf.GetString("pprof_user")
+	httpServer.PprofPassword = httpConf.GetString("pprof_password")
 	httpServer.EnableGzip = httpConf.GetBool("gzip")
+	if httpConf.IsSet("gzip_min_size") {
+		httpServer.CompressMinSize = httpConf.GetInt("gzip_min_size")
+	}
+	if httpConf.IsSet("shutdown_timeout") {
+		httpServer.ShutdownTimeout = time.Duration(httpConf.GetInt("shutdown_timeout")) * time.Second
+	}
+
+	httpServer.TLSCert = httpConf.GetString("tls_cert")
+	httpServer.TLSKey = httpConf.GetString("tls_key")
+	if httpConf.IsSet("https_port") {
+		httpServer.HttpsPort = httpConf.GetInt("https_port")
+	}
+	httpServer.HttpsRedirect = httpConf.GetBool("https_redirect")
+	httpServer.HSTSMaxAge = httpConf.GetInt("hsts")
+	httpServer.HSTSIncludeSubdomains = httpConf.GetBool("hsts_subdomains")
+
+	logConf := conf["log"]
+	httpServer.AccessLogFormat = logConf.GetString("access_log")
+	if logConf.IsSet("access_log_file") {
+		httpServer.AccessLogFile = logConf.GetString("access_log_file")
+	}
 
 	if appConf.IsSet("theme") {
 		SiteTheme = appConf.GetString("theme")
@@ -149,45 +256,88 @@ func Init() {
 // You can set config [fcgi] option to true if you want run server under fastcgi mode.
 // [http]
 // fcgi=true
-func Start() {
-	addHander()
+// Start blocks until the server is shut down by Shutdown, SIGINT or SIGTERM,
+// and returns nil after a graceful shutdown.
+func Start() error {
+	return defaultApp.Start()
+}
+
+func (a *App) Start() error {
+	if a.Config.PprofOn {
+		if _, err := a.checkPprof(); err != nil {
+			log.App.Error("pprof:", err)
+			return err
+		}
+	}
+	handler := a.Handler()
+
+	addr := fmt.Sprintf("%s:%d", a.Config.Addr, a.Config.Port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.App.Error(err)
+		return err
+	}
 
-	addr := fmt.Sprintf("%s:%d", httpServer.Addr, httpServer.Port)
-	if httpServer.UseFcgi {
+	stop := a.handleSignals()
+	defer stop()
+
+	if a.Config.PprofOn && a.Config.PprofAddr != "" {
+		a.startPprof()
+	}
+
+	if a.Config.UseFcgi {
 		startFcig()
+		a.serving(l)
 		log.App.Write("fastcgi start at ", addr)
-		l, err := net.Listen("tcp", addr)
-		if err != nil {
-			log.App.Fatalln(err)
-		}
-		fcgi.Serve(l, http.DefaultServeMux)
+		err = fcgi.Serve(l, a.trackInflight(handler))
+	} else if a.Config.TLSCert != "" {
+		err = a.serveTLS(l, handler)
 	} else {
+		server := &http.Server{Handler: handler}
+		a.serving(nil, server)
 		log.App.Write("server start at ", addr)
-		http.ListenAndServe(addr, http.DefaultServeMux)
+		err = server.Serve(l)
+	}
+
+	if done := a.shuttingDown(); done != nil {
+		<-done
+		return nil
 	}
+	log.App.Error(err)
+	return err
 }
 
-func addHander() {
-	if httpServer.PprofOn {
-		http.HandleFunc("/debug/pprof", nil)
+func (a *App) addHander() {
+	if a.Config.PprofOn && a.Config.PprofAddr == "" {
+		if prefix, err := a.checkPprof(); err != nil {
+			log.App.Alert("pprof is not mounted: ", err)
+		} else {
+			h := a.pprofHandler(prefix)
+			a.mux.Handle(prefix, h)
+			a.mux.Handle(prefix+"/", h)
+		}
 	}
 
-	if httpServer.EnablePing {
-		http.HandleFunc("/ping", pingHander)
+	if a.Config.EnablePing {
+		a.mux.HandleFunc("/ping", pingHander)
 	}
 
-	if httpServer.EnableApi {
-		http.HandleFunc("/api/", webapiHander)
+	if a.Config.EnableMetrics {
+		a.mux.HandleFunc(a.Config.MetricsPath, a.metricsHander)
 	}
 
-	if httpServer.EnableUpload {
-		http.HandleFunc("/upload/", uploadHander)
+	if a.Config.EnableApi {
+		a.mux.HandleFunc("/api/", a.webapiHander)
 	}
 
-	if httpServer.EnableWebSocket {
-		http.Handle("/ws/", websocket.Handler(websocketHander))
+	if a.Config.EnableUpload {
+		a.mux.HandleFunc("/upload/", a.uploadHander)
 	}
-	http.HandleFunc("/", serveHTTPHander)
+
+	if a.Config.EnableWebSocket {
+		a.mux.HandleFunc("/ws/", a.websocketHander)
+	}
+	a.mux.HandleFunc("/", a.serveHTTPHander)
 }
 
 func startFcig() {
@@ -202,71 +352,109 @@ func pingHander(rw http.ResponseWriter, req *http.Request) {
 	rw.Write([]byte("ok"))
 }
 
-func uploadHander(rw http.ResponseWriter, req *http.Request) {
+func (a *App) uploadHander(rw http.ResponseWriter, req *http.Request) {
 	var routeMatched *RouteMatched
-	if routeMatched = MatchFileuploadRoute([]byte(req.URL.Path)); routeMatched == nil {
-		http.Error(rw, "File Upload Page Not Found!", 404)
+	if routeMatched = a.MatchFileuploadRoute([]byte(req.URL.Path)); routeMatched == nil {
+		a.serveError(rw, req, 404, "File Upload Page Not Found!")
 		return
 	}
+	requestInfoOf(req).matched("upload", routeMatched)
 
 	if req.Method != "POST" {
-		http.Error(rw, "Forbidden", 403)
+		a.serveError(rw, req, 403, "Forbidden")
 		return
 	}
 
 	req.ParseMultipartForm(1 << 26)
 
 	prt := reflect.New(routeMatched.ClassType)
-	ctx := buildContext(rw, req, routeMatched)
+	ctx := a.buildContext(rw, req, routeMatched)
+	if !routeMatched.Route.runBeforeFilters(ctx) {
+		return
+	}
 
 	prt.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ctx), prt})
-	prt.MethodByName("InitData").Call(nil)
+	// Upload has no InitData, the handlers without it get Init
+	if m := prt.MethodByName("InitData"); m.IsValid() {
+		m.Call(nil)
+	} else {
+		prt.MethodByName("Init").Call(nil)
+	}
 	prt.MethodByName("DoUpload").Call(nil)
+
+	routeMatched.Route.runAfterFilters(ctx)
 }
 
-func websocketHander(ws *websocket.Conn) {
-	log.App.Info("websocket:", ws.RemoteAddr())
-	req := ws.Request()
+// websocketHander runs the route filters before the websocket handshake.
+// The after filters run when the connection is closed.
+func (a *App) websocketHander(rw http.ResponseWriter, req *http.Request) {
 	var routeMatched *RouteMatched
-	if routeMatched = MatchWebSocketRoute([]byte(req.URL.Path)); routeMatched == nil {
-		ws.Close()
+	if routeMatched = a.MatchWebSocketRoute([]byte(req.URL.Path)); routeMatched == nil {
+		a.serveError(rw, req, 404, "WebSocket Not Found!")
 		return
 	}
+	requestInfoOf(req).matched("websocket", routeMatched)
+
+	ctx := a.buildContext(rw, req, routeMatched)
+	if !routeMatched.Route.runBeforeFilters(ctx) {
+		return
+	}
+
+	websocket.Handler(func(ws *websocket.Conn) {
+		serveWebSocket(ws, ctx, routeMatched)
+	}).ServeHTTP(rw, req)
+
+	routeMatched.Route.runAfterFilters(ctx)
+}
 
+func serveWebSocket(ws *websocket.Conn, ctx *Context, routeMatched *RouteMatched) {
 	prt := reflect.New(routeMatched.ClassType)
-	s := websock.GetServer(routeMatched.ClassType.String())
+	s := routeMatched.Route.wsServer
 	if s == nil {
 		ws.Close()
 		return
 	}
 
 	prt.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ws), prt, reflect.ValueOf(s)})
+	prt.MethodByName("SetContext").Call([]reflect.Value{reflect.ValueOf(ctx)})
 	if isDie(prt.MethodByName("Init").Call(nil)) {
 		return
 	}
 	prt.MethodByName("Listen").Call(nil)
 }
 
-func webapiHander(rw http.ResponseWriter, req *http.Request) {
-	log.App.Info("webapi:", req.URL.Path)
-
+func (a *App) webapiHander(rw http.ResponseWriter, req *http.Request) {
 	var routeMatched *RouteMatched
-	if routeMatched = MatchWebApiRoute([]byte(req.URL.Path)); routeMatched == nil {
-		http.Error(rw, "Api Not Found!", 404)
+	if routeMatched = a.MatchWebApiRoute([]byte(req.URL.Path)); routeMatched == nil {
+		a.serveError(rw, req, 404, "Api Not Found!")
 		return
 	}
+	info := requestInfoOf(req)
+	info.matched("api", routeMatched)
 	prt := reflect.New(routeMatched.ClassType)
-	ctx := buildContext(rw, req, routeMatched)
+	ctx := a.buildContext(rw, req, routeMatched)
+	if !routeMatched.Route.runBeforeFilters(ctx) {
+		return
+	}
 	prt.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ctx), prt})
 
+	if isJSONRPC(req) {
+		if isDie(prt.MethodByName("Init").Call(nil)) {
+			return
+		}
+		a.serveJSONRPC(rw, ctx, prt, info)
+		routeMatched.Route.runAfterFilters(ctx)
+		return
+	}
+
 	if len(req.PostForm["json"]) == 0 {
-		NewError(0, "miss parameters!").Write(rw)
+		ctx.NewError(0, "miss parameters!").Write(rw)
 		return
 	}
 
 	data := &ApiParams{}
 	if err := json.Unmarshal([]byte(req.PostForm["json"][0]), data); err != nil {
-		NewError(0, err.Error()).Write(rw)
+		ctx.NewError(0, err.Error()).Write(rw)
 		return
 	}
 
@@ -275,10 +463,11 @@ func webapiHander(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	if prt.MethodByName(data.Method).Kind() == reflect.Invalid {
-		NewError(0, "invalid method:"+data.Method).Write(rw)
+		ctx.NewError(0, "invalid method:"+data.Method).Write(rw)
 		//ctx.Exit(500, "invalid function call")
 		return
 	}
+	info.ApiMethod = data.Method
 
 	var result []reflect.Value
 	if data.Args == nil {
@@ -288,113 +477,159 @@ func webapiHander(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	if len(result) != 2 {
-		NewError(0, "Web Service API Function must return (data, error)").Write(rw)
+		ctx.NewError(0, "Web Service API Function must return (data, error)").Write(rw)
 		return
 	}
 	prt.MethodByName("Reply").Call(result)
 
+	routeMatched.Route.runAfterFilters(ctx)
+
 }
 
-func serveHTTPHander(rw http.ResponseWriter, req *http.Request) {
-	log.App.Info(req.URL.Path)
+func (a *App) serveHTTPHander(rw http.ResponseWriter, req *http.Request) {
 	bPath := []byte(req.URL.Path)
-	bWebRoot := []byte(httpServer.WebRoot)
 
 	var routeMatched *RouteMatched
-	if routeMatched = MatchRoute(bPath); routeMatched == nil {
-		if bytes.Contains(bPath, B_DOT) {
-			http.ServeFile(rw, req, string(append(bWebRoot, bPath...)))
-		} else {
-			b := append(bWebRoot, bPath...)
-			http.ServeFile(rw, req, string(append(b, B_HTML_SUBFIX...)))
+	if routeMatched = a.MatchRoute(bPath); routeMatched == nil {
+		if a.assets.serve(rw, req) {
+			return
 		}
-		// http.Error(rw, "Page Not Found!", 404)
+		name := req.URL.Path
+		if !bytes.Contains(bPath, B_DOT) {
+			name += string(B_HTML_SUBFIX)
+		}
+		name = fsPath(name)
+		if !a.serveFile(rw, req, name) {
+			a.serveError(rw, req, 404, "Page Not Found!")
+		}
+		return
+	}
+
+	requestInfoOf(req).matched("page", routeMatched)
+
+	hook, ok := methodHooks[req.Method]
+	if !routeMatched.Route.IsAllowed(req.Method) || (!ok && req.Method != "OPTIONS") {
+		rw.Header().Set("Allow", strings.Join(routeMatched.Route.AllowedMethods(), ", "))
+		a.serveError(rw, req, 405, "Method Not Allowed")
+		return
+	}
+	if req.Method == "OPTIONS" {
+		rw.Header().Set("Allow", strings.Join(routeMatched.Route.AllowedMethods(), ", "))
+		rw.WriteHeader(200)
+		return
+	}
+
+	ctx := a.buildContext(rw, req, routeMatched)
+	if !routeMatched.Route.runBeforeFilters(ctx) {
 		return
 	}
 
-	ctx := buildContext(rw, req, routeMatched)
 	prt := reflect.New(routeMatched.ClassType)
 
 	prt.MethodByName("SetView").Call([]reflect.Value{reflect.ValueOf(routeMatched.ClassType.Name())})
 	prt.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ctx), prt})
 
+	if isDie(prt.MethodByName("Init").Call(nil)) {
+		return
+	}
+
 	doCache := false
 	v := prt.MethodByName("CheckCache").Call(nil)
+	// the waiting requests render the page themselves when it is not cached
+	defer func() {
+		if ctx.flight != nil {
+			a.finishFlight(ctx.flight, nil, time.Time{})
+		}
+	}()
 
 	switch int(v[0].Int()) {
 	case CACHE_FOUND:
+		if a.metrics != nil {
+			a.metrics.cacheResult(string(routeMatched.Route.Rule), true)
+		}
 		return
 	case CACHE_NOT_FOUND:
+		if a.metrics != nil {
+			a.metrics.cacheResult(string(routeMatched.Route.Rule), false)
+		}
 		doCache = true
 		// default:
 		// 	CACHE_DISABLED
 	}
 
-	if isDie(prt.MethodByName("Init").Call(nil)) {
+	// HEAD runs Get, net/http drops the body. A method allowed by
+	// Route.Methods may have no hook.
+	if m := prt.MethodByName(hook); m.IsValid() && isDie(m.Call(nil)) {
 		return
 	}
 
-	if req.Method == "POST" {
-		if isDie(prt.MethodByName("Post").Call(nil)) {
-			return
-		}
-
-	} else {
-		if isDie(prt.MethodByName("Get").Call(nil)) {
-			return
-		}
-	}
-
 	if isDie(prt.MethodByName("Action").Call(nil)) {
 		return
 	}
 
 	if doCache {
 		prt.MethodByName("CachePage").Call(nil)
-		return
+	} else {
+		prt.MethodByName("RenderPage").Call(nil)
 	}
 
-	prt.MethodByName("RenderPage").Call(nil)
+	routeMatched.Route.runAfterFilters(ctx)
 }
 
-func buildContext(rw http.ResponseWriter, req *http.Request, routeMatched *RouteMatched) *Context {
-	if req.Method == "POST" {
+func (a *App) buildContext(rw http.ResponseWriter, req *http.Request, routeMatched *RouteMatched) *Context {
+	switch req.Method {
+	case "POST", "PUT", "PATCH":
 		req.ParseForm()
 	}
 
-	return &Context{ResponseWriter: rw, Request: req, routerParams: routeMatched.Params}
+	return &Context{ResponseWriter: rw, Request: req, routerParams: routeMatched.Params, app: a}
 }
 
+// NewError creates a MyError without request, it gets the request id when
+// it is written to the response. See Context.NewError.
 func NewError(code int, messages ...interface{}) *MyError {
 	return &MyError{Code: code, Messages: messages}
 }
 
 type MyError struct {
-	Code     int
-	Messages []interface{}
+	Code      int
+	Messages  []interface{}
+	RequestId string
 }
 
+// Write writes the error as json. An error created without the request,
+// by NewError, gets the request id of the response writer, so the next Log
+// carries it.
 func (this *MyError) Write(w io.Writer) *MyError {
+	if rw, ok := w.(http.ResponseWriter); ok && this.RequestId == "" {
+		this.RequestId = rw.Header().Get("X-Request-ID")
+	}
 	w.Write([]byte(this.Json()))
 	return this
 }
 
 func (this *MyError) Log(strlevel string) *MyError {
+	args := []interface{}{"MYERR"}
+	if this.RequestId != "" {
+		args = append(args, "rid="+this.RequestId)
+	}
+	args = append(args, this.Code, fmt.Sprint(this.Messages...))
+
 	switch strlevel {
 	case "alert":
-		log.App.Alert("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Alert(args...)
 	case "crit":
-		log.App.Crit("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Crit(args...)
 	case "warn":
-		log.App.Warn("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Warn(args...)
 	case "notice":
-		log.App.Notice("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Notice(args...)
 	case "info":
-		log.App.Info("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Info(args...)
 	case "debug":
-		log.App.Debug("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Debug(args...)
 	default:
-		log.App.Error("MYERR", this.Code, fmt.Sprint(this.Messages...))
+		log.App.Error(args...)
 	}
 	return this
 }
@@ -407,6 +642,9 @@ func (this *MyError) Data() map[string]interface{} {
 	return m
 }
 func (this *MyError) Json() string {
+	if this.RequestId != "" {
+		return fmt.Sprintf("{\"code\":%d,\"message\":\"%s\", \"iserror\": true, \"request_id\": \"%s\"}", this.Code, fmt.Sprint(this.Messages...), this.RequestId)
+	}
 	return fmt.Sprintf("{\"code\":%d,\"message\":\"%s\", \"iserror\": true}", this.Code, fmt.Sprint(this.Messages...))
 }
 func (this *MyError) String() string {
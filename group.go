@@ -0,0 +1,70 @@
+package gos
+
+import (
+	"strings"
+)
+
+// RouteGroup registers routes under a shared prefix and filter chain.
+//
+//	admin := gos.Group("/admin", checkAdmin)
+//	admin.AddRoute("/products", (*ProductsPage)(nil))  // /admin/products
+//	admin.AddWebApiRoute("/product", (*ProductApi)(nil)) // /api/admin/product
+//
+// Filters are copied to the routes when they are added,
+// so set them up before adding routes.
+type RouteGroup struct {
+	app           *App
+	prefix        string
+	beforeFilters []func(ctx *Context) bool
+	afterFilters  []func(ctx *Context) bool
+}
+
+func Group(prefix string, filters ...func(ctx *Context) bool) *RouteGroup {
+	return defaultApp.Group(prefix, filters...)
+}
+
+func (a *App) Group(prefix string, filters ...func(ctx *Context) bool) *RouteGroup {
+	return &RouteGroup{
+		app:           a,
+		prefix:        strings.TrimSuffix(prefix, "/"),
+		beforeFilters: append(make([]func(ctx *Context) bool, 0), filters...),
+		afterFilters:  make([]func(ctx *Context) bool, 0)}
+}
+
+// Group creates a sub group inheriting the prefix and filters of g.
+func (g *RouteGroup) Group(prefix string, filters ...func(ctx *Context) bool) *RouteGroup {
+	sub := g.app.Group(g.prefix + prefix)
+	sub.beforeFilters = append(append(sub.beforeFilters, g.beforeFilters...), filters...)
+	sub.afterFilters = append(sub.afterFilters, g.afterFilters...)
+	return sub
+}
+
+func (g *RouteGroup) Before(filters ...func(ctx *Context) bool) *RouteGroup {
+	g.beforeFilters = append(g.beforeFilters, filters...)
+	return g
+}
+
+func (g *RouteGroup) After(filters ...func(ctx *Context) bool) *RouteGroup {
+	g.afterFilters = append(g.afterFilters, filters...)
+	return g
+}
+
+func (g *RouteGroup) AddRoute(rule string, clas interface{}) *Route {
+	return g.apply(g.app.AddRoute(g.prefix+rule, clas))
+}
+
+func (g *RouteGroup) AddWebApiRoute(rule string, clas interface{}) *Route {
+	return g.apply(g.app.AddWebApiRoute(g.prefix+rule, clas))
+}
+
+func (g *RouteGroup) AddFileUploadRoute(rule string, clas interface{}) *Route {
+	return g.apply(g.app.AddFileUploadRoute(g.prefix+rule, clas))
+}
+
+func (g *RouteGroup) AddWebSocketRoute(rule string, clas interface{}) *Route {
+	return g.apply(g.app.AddWebSocketRoute(g.prefix+rule, clas))
+}
+
+func (g *RouteGroup) apply(r *Route) *Route {
+	return r.Before(g.beforeFilters...).After(g.afterFilters...)
+}
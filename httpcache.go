@@ -0,0 +1,80 @@
+package gos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl is the HTTP cache policy of a page, set in Init:
+//
+//	this.CacheControl = &gos.CacheControl{Public: true, MaxAge: 60, StaleWhileRevalidate: 600, ETag: true}
+//
+// The pages with a policy answer If-None-Match and If-Modified-Since with 304.
+type CacheControl struct {
+	Public               bool // public, or private
+	MaxAge               int  // seconds, 0 for no-cache
+	StaleWhileRevalidate int  // seconds
+	ETag                 bool // send the hash of the page as ETag
+	WeakETag             bool
+	// LastModified of the page content, the time the page was cached
+	// when it is zero
+	LastModified time.Time
+}
+
+func (c *CacheControl) String() string {
+	parts := make([]string, 0, 3)
+	if c.Public {
+		parts = append(parts, "public")
+	} else {
+		parts = append(parts, "private")
+	}
+	if c.MaxAge > 0 {
+		parts = append(parts, "max-age="+strconv.Itoa(c.MaxAge))
+	} else {
+		parts = append(parts, "no-cache")
+	}
+	if c.StaleWhileRevalidate > 0 {
+		parts = append(parts, "stale-while-revalidate="+strconv.Itoa(c.StaleWhileRevalidate))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func etagOf(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since
+// when the request has no If-None-Match.
+func notModified(req *http.Request, etag string, modified time.Time) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := req.Header.Get("If-Modified-Since"); since != "" && !modified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
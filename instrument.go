@@ -0,0 +1,129 @@
+package gos
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+type requestInfoKey struct{}
+
+// requestInfo is filled by the handlers while serving a request,
+// it is used for metrics and the access log.
+type requestInfo struct {
+	Start     time.Time
+	RequestId string
+	UserId    int64
+	Handler   string // page, api, upload, websocket, static
+	Route     string // matched route rule
+	Params    map[string]string
+	ApiMethod string
+	Status    int
+	Bytes     int64
+}
+
+// requestInfoOf returns the info of the request, or a dummy one
+// when the request is not served by App.Handler.
+func requestInfoOf(req *http.Request) *requestInfo {
+	if info, ok := req.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info
+	}
+	return &requestInfo{UserId: -1}
+}
+
+func (info *requestInfo) matched(handler string, r *RouteMatched) {
+	info.Handler = handler
+	if r != nil && r.Route != nil {
+		info.Route = string(r.Route.Rule)
+		info.Params = r.Params
+	}
+}
+
+// instrument is the outermost handler of the app.
+func (a *App) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		info := &requestInfo{Start: time.Now(), Handler: "static", UserId: -1}
+		info.RequestId = requestId(req)
+		rw.Header().Set("X-Request-ID", info.RequestId)
+
+		sw := &statusWriter{ResponseWriter: rw}
+		req = req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, info))
+
+		h.ServeHTTP(sw, req)
+
+		info.Status = sw.status
+		if info.Status == 0 {
+			info.Status = 200
+		}
+		info.Bytes = sw.bytes
+		d := time.Since(info.Start)
+		if a.metrics != nil {
+			a.metrics.observe(info, d)
+		}
+		if a.accessLog != nil {
+			a.accessLog.write(info, req, d)
+		}
+	})
+}
+
+// requestId keeps the X-Request-ID sent by a proxy, or generates one.
+func requestId(req *http.Request) string {
+	if id := req.Header.Get("X-Request-ID"); id != "" && len(id) <= 128 {
+		valid := true
+		for _, c := range id {
+			if c < 0x21 || c > 0x7e {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return id
+		}
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusWriter records the status code and the size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = 200
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.status = http.StatusSwitchingProtocols
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack is not supported")
+}
@@ -0,0 +1,268 @@
+package gos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jiorry/libs/log"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCServerError    = -32000 // errors returned by the api methods
+)
+
+// RPCMaxBody limits the size of a JSON-RPC request body.
+var RPCMaxBody int64 = 4 << 20
+
+// RPCError is the error of a JSON-RPC response. An api method returns it
+// to choose the code, any other error is sent with RPCServerError.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"` // nil for a notification
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+var (
+	rpcNull   = json.RawMessage("null")
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// isJSONRPC reports whether an api request is a JSON-RPC call,
+// i.e. a POST of application/json.
+func isJSONRPC(req *http.Request) bool {
+	if req.Method != "POST" {
+		return false
+	}
+	typ, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return typ == "application/json"
+}
+
+// serveJSONRPC calls the methods of the api by a JSON-RPC 2.0 request
+// or batch. The method of a call returns (data, error) and its params
+// are decoded into the parameter types of the method:
+//
+//	func (a *ProductApi) Find(q *ProductQuery) (interface{}, error)  // {"params": {"name": "pen"}}
+//	func (a *ProductApi) Move(id int64, to string) (interface{}, error) // {"params": [42, "shelf"]}
+//
+// A single slice parameter takes the whole params array.
+func (a *App) serveJSONRPC(rw http.ResponseWriter, ctx *Context, prt reflect.Value, info *requestInfo) {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, ctx.Request.Body, RPCMaxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			a.writeRPC(rw, http.StatusRequestEntityTooLarge, rpcFailure(rpcNull, RPCInvalidRequest, "request body too large"))
+			return
+		}
+		a.writeRPC(rw, 200, rpcFailure(rpcNull, RPCParseError, err.Error()))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		// the method of the client is the label only when it is found
+		info.ApiMethod = "unknown"
+		if res := a.callRPC(ctx, prt, body, info); res != nil {
+			a.writeRPC(rw, 200, res)
+		} else {
+			rw.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		a.writeRPC(rw, 200, rpcFailure(rpcNull, RPCParseError, err.Error()))
+		return
+	}
+	if len(batch) == 0 {
+		a.writeRPC(rw, 200, rpcFailure(rpcNull, RPCInvalidRequest, "empty batch"))
+		return
+	}
+
+	info.ApiMethod = "batch"
+	result := make([]*rpcResponse, 0, len(batch))
+	for _, raw := range batch {
+		if res := a.callRPC(ctx, prt, raw, nil); res != nil {
+			result = append(result, res)
+		}
+	}
+	if len(result) == 0 {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	a.writeRPC(rw, 200, result)
+}
+
+func (a *App) writeRPC(rw http.ResponseWriter, code int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		log.App.Crit(err)
+	}
+}
+
+// callRPC runs a call, it returns nil for a notification.
+// info gets the method of a single call.
+func (a *App) callRPC(ctx *Context, prt reflect.Value, raw []byte, info *requestInfo) (res *rpcResponse) {
+	var r rpcRequest
+	if err := json.Unmarshal(raw, &r); err != nil {
+		code := RPCInvalidRequest
+		if _, ok := err.(*json.SyntaxError); ok || !json.Valid(raw) {
+			code = RPCParseError
+		}
+		return rpcFailure(rpcNull, code, err.Error())
+	}
+
+	id := r.Id
+	if id != nil && !validRPCId(id) {
+		return rpcFailure(rpcNull, RPCInvalidRequest, "invalid id")
+	}
+	if r.Version != "2.0" || r.Method == "" {
+		if id == nil {
+			id = rpcNull
+		}
+		return rpcFailure(id, RPCInvalidRequest, "invalid request")
+	}
+
+	result, rpcErr := a.invokeRPC(ctx, prt, &r, info)
+	if id == nil {
+		return nil
+	}
+
+	res = &rpcResponse{Version: "2.0", Error: rpcErr, Id: id}
+	if rpcErr == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			res.Error = &RPCError{Code: RPCInternalError, Message: err.Error()}
+		} else {
+			res.Result = b
+		}
+	}
+	return res
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	return &rpcResponse{Version: "2.0", Error: &RPCError{Code: code, Message: message}, Id: id}
+}
+
+// validRPCId reports whether id is a string, a number or null.
+func validRPCId(id json.RawMessage) bool {
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
+
+func (a *App) invokeRPC(ctx *Context, prt reflect.Value, r *rpcRequest, info *requestInfo) (result interface{}, rpcErr *RPCError) {
+	m := prt.MethodByName(r.Method)
+	if !m.IsValid() || strings.HasPrefix(r.Method, "rpc.") || !isApiMethod(m.Type()) {
+		return nil, &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + r.Method}
+	}
+	if info != nil {
+		info.ApiMethod = r.Method
+	}
+
+	args, err := rpcArgs(m.Type(), r.Params)
+	if err != nil {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			log.App.Error("rid="+requestInfoOf(ctx.Request).RequestId, "panic:", err, "jsonrpc", r.Method, "\n"+string(debug.Stack()))
+			rpcErr = &RPCError{Code: RPCInternalError, Message: "internal error"}
+		}
+	}()
+
+	out := m.Call(args)
+	if e, _ := out[1].Interface().(error); e != nil {
+		if re, ok := e.(*RPCError); ok {
+			return nil, re
+		}
+		return nil, &RPCError{Code: RPCServerError, Message: e.Error()}
+	}
+	return out[0].Interface(), nil
+}
+
+// isApiMethod reports whether a method returns (data, error).
+func isApiMethod(t reflect.Type) bool {
+	return t.NumOut() == 2 && t.Out(1) == errorType
+}
+
+// rpcArgs decodes params into the parameters of a method, by position
+// for an array and into the only parameter for an object.
+// Missing params are zero values.
+func rpcArgs(t reflect.Type, params json.RawMessage) ([]reflect.Value, error) {
+	n := t.NumIn()
+	args := make([]reflect.Value, n)
+	for i := range args {
+		args[i] = reflect.New(t.In(i)).Elem()
+	}
+	if len(params) == 0 || bytes.Equal(params, rpcNull) {
+		return args, nil
+	}
+
+	switch params[0] {
+	case '[':
+		// a single slice parameter takes the whole array
+		if n == 1 && (t.In(0).Kind() == reflect.Slice || t.In(0).Kind() == reflect.Array) {
+			if json.Unmarshal(params, args[0].Addr().Interface()) == nil {
+				return args, nil
+			}
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(params, &list); err != nil {
+			return nil, err
+		}
+		if len(list) != n {
+			return nil, fmt.Errorf("%d params expected, got %d", n, len(list))
+		}
+		for i, p := range list {
+			if err := json.Unmarshal(p, args[i].Addr().Interface()); err != nil {
+				return nil, fmt.Errorf("param %d: %v", i, err)
+			}
+		}
+	case '{':
+		if n != 1 {
+			return nil, fmt.Errorf("%d params expected by position", n)
+		}
+		if err := json.Unmarshal(params, args[0].Addr().Interface()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("params must be an array or an object")
+	}
+	return args, nil
+}
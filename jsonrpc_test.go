@@ -0,0 +1,152 @@
+package gos
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type rpcTestQuery struct {
+	Name  string
+	Limit int
+}
+
+type rpcTestApi struct {
+	WebApi
+}
+
+func (a *rpcTestApi) Find(q *rpcTestQuery) (interface{}, error) {
+	return strings.Repeat(q.Name, q.Limit), nil
+}
+
+func (a *rpcTestApi) Add(x, y int) (interface{}, error) {
+	return x + y, nil
+}
+
+func (a *rpcTestApi) Sum(v []int) (interface{}, error) {
+	s := 0
+	for _, i := range v {
+		s += i
+	}
+	return s, nil
+}
+
+func (a *rpcTestApi) Fail() (interface{}, error) {
+	return nil, errors.New("boom")
+}
+
+func (a *rpcTestApi) Custom() (interface{}, error) {
+	return nil, &RPCError{Code: 7, Message: "custom"}
+}
+
+func (a *rpcTestApi) Panic() (interface{}, error) {
+	panic("panic")
+}
+
+func (a *rpcTestApi) Nil() (interface{}, error) {
+	return nil, nil
+}
+
+func rpcTestCall(a *App, body string) (int, string, *requestInfo) {
+	req := httptest.NewRequest("POST", "/api/t", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rw := httptest.NewRecorder()
+	ctx := &Context{ResponseWriter: rw, Request: req, app: a}
+	prt := reflect.New(reflect.TypeOf(rpcTestApi{}))
+	prt.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ctx), prt})
+	info := &requestInfo{}
+	a.serveJSONRPC(rw, ctx, prt, info)
+	return rw.Code, strings.TrimSpace(rw.Body.String()), info
+}
+
+func TestJSONRPC(t *testing.T) {
+	a := NewApp()
+	tests := []struct {
+		name, body, want, method string
+	}{
+		{"object params", `{"jsonrpc":"2.0","method":"Find","params":{"Name":"ab","Limit":2},"id":1}`,
+			`{"jsonrpc":"2.0","result":"abab","id":1}`, "Find"},
+		{"positional params", `{"jsonrpc":"2.0","method":"Add","params":[2,3],"id":"a"}`,
+			`{"jsonrpc":"2.0","result":5,"id":"a"}`, "Add"},
+		{"slice param takes the array", `{"jsonrpc":"2.0","method":"Sum","params":[1,2,3],"id":2}`,
+			`{"jsonrpc":"2.0","result":6,"id":2}`, "Sum"},
+		{"slice param by position", `{"jsonrpc":"2.0","method":"Sum","params":[[1,2]],"id":2}`,
+			`{"jsonrpc":"2.0","result":3,"id":2}`, "Sum"},
+		{"null id", `{"jsonrpc":"2.0","method":"Nil","id":null}`,
+			`{"jsonrpc":"2.0","result":null,"id":null}`, "Nil"},
+		{"error", `{"jsonrpc":"2.0","method":"Fail","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32000,"message":"boom"},"id":3}`, "Fail"},
+		{"rpc error", `{"jsonrpc":"2.0","method":"Custom","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":7,"message":"custom"},"id":3}`, "Custom"},
+		{"panic", `{"jsonrpc":"2.0","method":"Panic","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32603,"message":"internal error"},"id":3}`, "Panic"},
+		{"not an api method", `{"jsonrpc":"2.0","method":"Prepare","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found: Prepare"},"id":3}`, "unknown"},
+		{"unknown method", `{"jsonrpc":"2.0","method":"Zzz123","id":3}`,
+			`"code":-32601`, "unknown"},
+		{"missing param", `{"jsonrpc":"2.0","method":"Add","params":[1],"id":4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"2 params expected, got 1"},"id":4}`, "Add"},
+		{"wrong param type", `{"jsonrpc":"2.0","method":"Add","params":["x",1],"id":4}`,
+			`"code":-32602`, "Add"},
+		{"object for two params", `{"jsonrpc":"2.0","method":"Add","params":{"x":1},"id":4}`,
+			`"code":-32602`, "Add"},
+		{"invalid method", `{"jsonrpc":"2.0","method":1}`, `"code":-32600`, "unknown"},
+		{"invalid version", `{"jsonrpc":"1.0","method":"Nil","id":5}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":5}`, "unknown"},
+		{"invalid id", `{"jsonrpc":"2.0","method":"Nil","id":{}}`, `"code":-32600`, "unknown"},
+		{"parse error", `{"jsonrpc":"2.0","method"`, `{"jsonrpc":"2.0","error":{"code":-32700`, "unknown"},
+		{"empty batch", `[]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`, ""},
+		{"invalid batch", `[1,"x"]`,
+			`[{"jsonrpc":"2.0","error":{"code":-32600`, "batch"},
+		{"broken batch", `[{"jsonrpc":"2.0","method":"Nil","id":1},`, `"code":-32700`, ""},
+		{"batch", `[{"jsonrpc":"2.0","method":"Add","params":[1,1],"id":1},{"jsonrpc":"2.0","method":"Add","params":[1,1]},{"jsonrpc":"2.0","method":"Nil","id":2}]`,
+			`[{"jsonrpc":"2.0","result":2,"id":1},{"jsonrpc":"2.0","result":null,"id":2}]`, "batch"},
+	}
+	for _, tt := range tests {
+		code, body, info := rpcTestCall(a, tt.body)
+		if code != 200 || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: got %d %s, want %s", tt.name, code, body, tt.want)
+		}
+		if info.ApiMethod != tt.method {
+			t.Errorf("%s: api method %q, want %q", tt.name, info.ApiMethod, tt.method)
+		}
+	}
+}
+
+func TestJSONRPCNotification(t *testing.T) {
+	a := NewApp()
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"Add","params":[1,1]}`,
+		`{"jsonrpc":"2.0","method":"Fail"}`,
+		`[{"jsonrpc":"2.0","method":"Nil"},{"jsonrpc":"2.0","method":"Zzz"}]`,
+	} {
+		if code, res, _ := rpcTestCall(a, body); code != 204 || res != "" {
+			t.Errorf("%s: got %d %s", body, code, res)
+		}
+	}
+}
+
+func TestJSONRPCBodyLimit(t *testing.T) {
+	defer func(n int64) { RPCMaxBody = n }(RPCMaxBody)
+	RPCMaxBody = 16
+
+	code, body, _ := rpcTestCall(NewApp(), `{"jsonrpc":"2.0","method":"Nil","id":1}`)
+	if code != 413 || !strings.Contains(body, `"code":-32600`) {
+		t.Errorf("got %d %s", code, body)
+	}
+}
+
+func TestJSONRPCRoute(t *testing.T) {
+	a := NewApp()
+	a.AddWebApiRoute("/t", (*rpcTestApi)(nil))
+
+	req := httptest.NewRequest("POST", "/api/t", strings.NewReader(`{"jsonrpc":"2.0","method":"Add","params":[1,2],"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, req)
+	if body := strings.TrimSpace(rw.Body.String()); body != `{"jsonrpc":"2.0","result":3,"id":1}` {
+		t.Error(body)
+	}
+}
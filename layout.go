@@ -13,27 +13,37 @@ type AppLayout struct {
 	bottomRender  IRender
 
 	RenderFunc func(*AppLayout, io.Writer)
+	app        *App
+	ctx        *Context
 }
 
 func (this *AppLayout) TopView(theme string, name string, data interface{}) {
 	this.topRender = &TemplateRender{
 		View: &ThemeItem{theme, "template", name, nil},
-		Data: data}
+		Data: data,
+		app:  this.app,
+		ctx:  this.ctx}
 }
 func (this *AppLayout) HeaderView(theme string, name string, data interface{}) {
 	this.headerRender = &TemplateRender{
 		View: &ThemeItem{theme, "template", name, nil},
-		Data: data}
+		Data: data,
+		app:  this.app,
+		ctx:  this.ctx}
 }
 func (this *AppLayout) FooterView(theme string, name string, data interface{}) {
 	this.footerRender = &TemplateRender{
 		View: &ThemeItem{theme, "template", name, nil},
-		Data: data}
+		Data: data,
+		app:  this.app,
+		ctx:  this.ctx}
 }
 func (this *AppLayout) BottomView(theme string, name string, data interface{}) {
 	this.bottomRender = &TemplateRender{
 		View: &ThemeItem{theme, "template", name, nil},
-		Data: data}
+		Data: data,
+		app:  this.app,
+		ctx:  this.ctx}
 }
 
 func (this *AppLayout) GetTopRender() IRender {
@@ -104,28 +114,34 @@ var (
 	b_s3 = []byte("'</script>")
 )
 
-func (this *AppLayout) RenderLayout(writer io.Writer) {
+// RenderLayout stops at the first render error.
+func (this *AppLayout) RenderLayout(writer io.Writer) error {
 	if this.RenderFunc != nil {
 		this.RenderFunc(this, writer)
-		return
+		return nil
 	}
 	writer.Write(B_HTML_BEGIN)
-	this.headLayout.RenderLayout(writer)
+	if err := this.headLayout.RenderLayout(writer); err != nil {
+		return err
+	}
 	writer.Write(B_HTML_BODY_BEGIN)
-	this.topRender.Render(writer)
-	this.headerRender.Render(writer)
-	this.contextRender.Render(writer)
-	this.footerRender.Render(writer)
-	this.bottomRender.Render(writer)
+	for _, r := range []IRender{this.topRender, this.headerRender, this.contextRender, this.footerRender, this.bottomRender} {
+		if err := render(r, writer); err != nil {
+			return err
+		}
+	}
 	writer.Write(b_s1)
-	writer.Write([]byte(RunMode))
+	writer.Write([]byte(appOrDefault(this.app).runMode()))
 	writer.Write(b_s2)
 	writer.Write([]byte(SiteTheme))
 	writer.Write(b_s3)
-	this.headLayout.RenderBottomJs(writer)
+	if err := this.headLayout.RenderBottomJs(writer); err != nil {
+		return err
+	}
 
 	writer.Write(B_HTML_BODY_END)
-	writer.Write(B_HTML_END)
+	_, err := writer.Write(B_HTML_END)
+	return err
 }
 
 type HeadLayout struct {
@@ -136,18 +152,26 @@ type HeadLayout struct {
 	JsRender       IRender
 }
 
-func (this *HeadLayout) RenderLayout(writer io.Writer) {
+func (this *HeadLayout) RenderLayout(writer io.Writer) error {
 	writer.Write([]byte("<head>\n"))
-	this.HeadItemRender.Render(writer)
-	this.CssRender.Render(writer)
+	if err := render(this.HeadItemRender, writer); err != nil {
+		return err
+	}
+	if err := render(this.CssRender, writer); err != nil {
+		return err
+	}
 	if this.JsPosition == "head" {
-		this.JsRender.Render(writer)
+		if err := render(this.JsRender, writer); err != nil {
+			return err
+		}
 	}
-	writer.Write([]byte("<title>" + this.Title + "</title>\n</head>\n"))
+	_, err := writer.Write([]byte("<title>" + this.Title + "</title>\n</head>\n"))
+	return err
 }
 
-func (this *HeadLayout) RenderBottomJs(writer io.Writer) {
+func (this *HeadLayout) RenderBottomJs(writer io.Writer) error {
 	if this.JsPosition != "head" {
-		this.JsRender.Render(writer)
+		return render(this.JsRender, writer)
 	}
+	return nil
 }
@@ -0,0 +1,180 @@
+package gos
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latency histogram buckets in seconds
+var metricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricsKey struct {
+	handler, route, apiMethod, status string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+type cacheKey struct {
+	route, result string
+}
+
+// appMetrics collects the request metrics of an app and writes them
+// in the Prometheus text exposition format.
+type appMetrics struct {
+	mu        sync.Mutex
+	durations map[metricsKey]*histogram
+	cache     map[cacheKey]uint64
+}
+
+func newAppMetrics() *appMetrics {
+	return &appMetrics{
+		durations: make(map[metricsKey]*histogram),
+		cache:     make(map[cacheKey]uint64)}
+}
+
+func (m *appMetrics) observe(info *requestInfo, d time.Duration) {
+	key := metricsKey{info.Handler, info.Route, info.ApiMethod, strconv.Itoa(info.Status)}
+	seconds := d.Seconds()
+
+	m.mu.Lock()
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(metricsBuckets))}
+		m.durations[key] = h
+	}
+	for i, b := range metricsBuckets {
+		if seconds <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+	m.mu.Unlock()
+}
+
+// cacheResult counts the page cache hit or miss of a route.
+func (m *appMetrics) cacheResult(route string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.mu.Lock()
+	m.cache[cacheKey{route, result}]++
+	m.mu.Unlock()
+}
+
+func (a *App) metricsHander(rw http.ResponseWriter, req *http.Request) {
+	requestInfoOf(req).Handler = "metrics"
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	a.metrics.write(rw)
+	a.writeWebSocketMetrics(rw)
+	writeRuntimeMetrics(rw)
+}
+
+func (m *appMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricsKey, 0, len(m.durations))
+	for k := range m.durations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	fmt.Fprintln(w, "# HELP gos_http_requests_total Number of HTTP requests.")
+	fmt.Fprintln(w, "# TYPE gos_http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "gos_http_requests_total{%s} %d\n", k.labels(), m.durations[k].count)
+	}
+
+	fmt.Fprintln(w, "# HELP gos_http_request_duration_seconds HTTP request latency.")
+	fmt.Fprintln(w, "# TYPE gos_http_request_duration_seconds histogram")
+	for _, k := range keys {
+		h := m.durations[k]
+		labels := k.labels()
+		var cumulative uint64
+		for i, b := range metricsBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "gos_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(b, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "gos_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "gos_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "gos_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	cacheKeys := make([]cacheKey, 0, len(m.cache))
+	for k := range m.cache {
+		cacheKeys = append(cacheKeys, k)
+	}
+	sort.Slice(cacheKeys, func(i, j int) bool {
+		return cacheKeys[i].route+cacheKeys[i].result < cacheKeys[j].route+cacheKeys[j].result
+	})
+
+	fmt.Fprintln(w, "# HELP gos_page_cache_total Page cache lookups by result.")
+	fmt.Fprintln(w, "# TYPE gos_page_cache_total counter")
+	for _, k := range cacheKeys {
+		fmt.Fprintf(w, "gos_page_cache_total{route=\"%s\",result=\"%s\"} %d\n", escapeLabel(k.route), k.result, m.cache[k])
+	}
+}
+
+func (k metricsKey) labels() string {
+	return fmt.Sprintf("handler=\"%s\",route=\"%s\",api_method=\"%s\",status=\"%s\"",
+		escapeLabel(k.handler), escapeLabel(k.route), escapeLabel(k.apiMethod), k.status)
+}
+
+func escapeLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return strings.Replace(v, "\n", `\n`, -1)
+}
+
+func (a *App) writeWebSocketMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP gos_websocket_clients Active websocket clients.")
+	fmt.Fprintln(w, "# TYPE gos_websocket_clients gauge")
+	for _, r := range a.wsRoutes.list {
+		name := r.ClassType.String()
+		if s := r.wsServer; s != nil {
+			fmt.Fprintf(w, "gos_websocket_clients{server=\"%s\"} %d\n", escapeLabel(name), s.ClientCount())
+		}
+	}
+}
+
+func writeRuntimeMetrics(w io.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	metrics := []struct {
+		name, typ, help string
+		value           float64
+	}{
+		{"go_goroutines", "gauge", "Number of goroutines.", float64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", "gauge", "Bytes of allocated heap objects.", float64(ms.Alloc)},
+		{"go_memstats_alloc_bytes_total", "counter", "Cumulative bytes allocated for heap objects.", float64(ms.TotalAlloc)},
+		{"go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(ms.Sys)},
+		{"go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.", float64(ms.HeapInuse)},
+		{"go_memstats_heap_objects", "gauge", "Number of allocated heap objects.", float64(ms.HeapObjects)},
+		{"go_memstats_mallocs_total", "counter", "Cumulative count of heap objects allocated.", float64(ms.Mallocs)},
+		{"go_memstats_frees_total", "counter", "Cumulative count of heap objects freed.", float64(ms.Frees)},
+		{"go_memstats_last_gc_time_seconds", "gauge", "Time of the last garbage collection.", float64(ms.LastGC) / 1e9},
+		{"go_gc_cycles_total", "counter", "Number of completed GC cycles.", float64(ms.NumGC)},
+		{"go_gc_pause_seconds_total", "counter", "Cumulative GC pause time.", float64(ms.PauseTotalNs) / 1e9},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, m.help, m.name, m.typ, m.name, strconv.FormatFloat(m.value, 'g', -1, 64))
+	}
+}
@@ -0,0 +1,34 @@
+package gos
+
+import (
+	"net/http"
+)
+
+// Middleware wraps the handler of every request served by gos,
+// including pages, /api/, /upload/, /ws/, /ping and static files.
+type Middleware func(http.Handler) http.Handler
+
+// Use adds middlewares to the chain. The first one added is the outermost.
+//
+//	gos.Use(func(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+//			rw.Header().Set("Access-Control-Allow-Origin", "*")
+//			next.ServeHTTP(rw, req)
+//		})
+//	})
+func Use(m ...Middleware) {
+	defaultApp.Use(m...)
+}
+
+// Use adds middlewares to the chain of the app.
+// They must be added before the app serves its first request.
+func (a *App) Use(m ...Middleware) {
+	a.middlewares = append(a.middlewares, m...)
+}
+
+func (a *App) applyMiddlewares(h http.Handler) http.Handler {
+	for i := len(a.middlewares) - 1; i >= 0; i-- {
+		h = a.middlewares[i](h)
+	}
+	return h
+}
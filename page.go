@@ -3,15 +3,14 @@ package gos
 import (
 	"bytes"
 	"github.com/jiorry/libs/log"
-	"github.com/jiorry/libs/util"
 	"net/http"
-	"os"
 	"reflect"
+	"time"
 )
 
 type PageCache struct {
-	Type   string //none, file, cache
-	Expire int64
+	Type   string //none, memory, file, cache
+	Expire int64  // seconds
 }
 type Page struct {
 	View  *ThemeItem
@@ -23,12 +22,15 @@ type Page struct {
 	Timestamp  string
 	JsPosition string // head or end
 
-	Cache  *PageCache
-	Ctx    *Context
-	Data   interface{}
-	Layout *AppLayout
-	parent interface{}
-	auth   *UserAuth
+	Cache        *PageCache
+	CacheControl *CacheControl
+	Ctx          *Context
+	Data         interface{}
+	Layout       *AppLayout
+	ViewLayout   string // layout template of the View, see SetViewLayout
+	parent       interface{}
+	auth         *UserAuth
+	cacheKey     string
 }
 
 type IPage interface {
@@ -55,6 +57,13 @@ func (p *Page) SetView(viewName string) *Page {
 	return p
 }
 
+// SetViewLayout renders the View by a layout template of the same folder,
+// e.g. SetViewLayout("layouts/base") for template/layouts/base.htm.
+func (p *Page) SetViewLayout(name string) *Page {
+	p.ViewLayout = name
+	return p
+}
+
 func (p *Page) SetThemeView(theme string, viewName string) *Page {
 	p.View = &ThemeItem{theme, "template", viewName, nil}
 	return p
@@ -112,88 +121,169 @@ func (p *Page) Prepare(ct *Context, parent interface{}) {
 		headerRender:  RenderNothing,
 		contextRender: RenderNothing,
 		footerRender:  RenderNothing,
-		bottomRender:  RenderNothing}
+		bottomRender:  RenderNothing,
+		app:           ct.App(),
+		ctx:           ct}
 }
 
 func (p *Page) RenderPage() {
 	// If WriteHeader has not yet been called, Write calls WriteHeader(http.StatusOK)
 	// p.Ctx.ResponseWriter.WriteHeader(200)
-	p.BuildLayout().RenderLayout(p.Ctx.ResponseWriter)
+	if body, ok := p.render(); ok {
+		p.writePage(body, time.Time{})
+	}
+}
+
+// writePage writes the body with the CacheControl headers,
+// or 304 when the client has it.
+func (p *Page) writePage(body []byte, modified time.Time) {
+	header := p.Ctx.ResponseWriter.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	if cc := p.CacheControl; cc != nil {
+		header.Set("Cache-Control", cc.String())
+		var etag string
+		if cc.ETag {
+			etag = etagOf(body, cc.WeakETag)
+			header.Set("ETag", etag)
+		}
+		if !cc.LastModified.IsZero() {
+			modified = cc.LastModified
+		}
+		if !modified.IsZero() {
+			header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+		if notModified(p.Ctx.Request, etag, modified) {
+			header.Del("Content-Type")
+			p.Ctx.NotModified()
+			return
+		}
+	}
+
+	p.Ctx.ResponseWriter.Write(body)
+}
+
+// render returns the page, or writes the error.
+func (p *Page) render() ([]byte, bool) {
+	var buf bytes.Buffer
+	if err := p.BuildLayout().RenderLayout(&buf); err != nil {
+		if p.Ctx.err != nil {
+			// an error page failed, renderErrorPage falls back to the plain error
+			panic(err)
+		}
+		p.Ctx.App().internalError(p.Ctx.ResponseWriter, p.Ctx.Request, err, nil)
+		return nil, false
+	}
+	return buf.Bytes(), true
 }
 
+// CheckCache writes the cached page. It runs after Init, which sets
+// the Cache of the page:
+//
+//	this.Cache.Type = "memory" // memory, file, cache or a type added by SetPageCacheStore
+//	this.Cache.Expire = 600    // seconds, 0 for no expiry
+//
+// Pages are cached for GET and HEAD out of dev mode.
 func (p *Page) CheckCache() int {
-	if RunMode != "pro" {
+	if p.Ctx.App().runMode() == "dev" || p.Cache == nil {
+		return CACHE_DISABLED
+	}
+	if m := p.Ctx.Request.Method; m != "GET" && m != "HEAD" {
+		return CACHE_DISABLED
+	}
+	app := p.Ctx.App()
+	store := app.pageStore(p.Cache.Type)
+	if store == nil {
+		return CACHE_DISABLED
+	}
+
+	if p.cacheKey = app.cacheKey(p.Ctx); p.cacheKey == "" {
+		return CACHE_DISABLED
+	}
+	flightKey := p.Cache.Type + "|" + p.cacheKey
+	if app.isUncached(flightKey) {
 		return CACHE_DISABLED
 	}
+	if c, ok := getCachedPage(store, p.cacheKey); ok {
+		p.writePage(c.Body, c.Modified)
+		return CACHE_FOUND
+	}
 
-	filename := "var/cache" + p.Ctx.Request.RequestURI + ".html"
-	switch p.Cache.Type {
-	case "file":
-		if _, err := os.Stat(filename); err != nil {
-			if os.IsNotExist(err) {
-				return CACHE_NOT_FOUND
-			}
-			return CACHE_NOT_FOUND
+	// one request renders the missing page, the others share it
+	f, leader := app.joinFlight(flightKey)
+	if !leader {
+		select {
+		case <-f.done:
+		case <-p.Ctx.Request.Context().Done():
+			return CACHE_FOUND
+		}
+		if f.body == nil {
+			// not rendered by the leader, render it for this request
+			return CACHE_DISABLED
 		}
-		http.ServeFile(p.Ctx.ResponseWriter, p.Ctx.Request, filename)
+		p.writePage(f.body, f.modified)
 		return CACHE_FOUND
 	}
-	return CACHE_DISABLED
-}
 
-var cachePathList []string = make([]string, 0)
+	// the page may be stored since the lookup
+	if c, ok := getCachedPage(store, p.cacheKey); ok {
+		app.finishFlight(f, c.Body, c.Modified)
+		p.writePage(c.Body, c.Modified)
+		return CACHE_FOUND
+	}
+	p.Ctx.flight = f
+	return CACHE_NOT_FOUND
+}
 
-// check cache file, if cache file is exists, it will return content by cache and
-// if cache file is not exists, it will create cache file
-// filename=/content/cid?abc=123
-// the dir /var/content and file /var/content/cid?abc=123 will be created.
+// CachePage renders the page and stores it.
 func (p *Page) CachePage() {
-	if p.Cache.Type == "file" {
-		filename := "var/cache" + p.Ctx.Request.RequestURI + ".html"
-		uri := []byte(p.Ctx.Request.RequestURI)
-		n := bytes.Index(uri, []byte("?"))
-		var t []byte
-
-		if n != -1 {
-			t = bytes.Trim(uri[:n], "/")
-		} else {
-			t = bytes.Trim(uri, "/")
-		}
-		arr := bytes.Split(t, []byte("/"))
-		// prepare dir, if dir is not exists , it will be create.
-		path := "var/cache/"
-		count := len(arr) - 1
-		for i := 0; i < count; i++ {
-			path += string(arr[i]) + "/"
-
-			if util.InStringArray(cachePathList, path) {
-				continue
-			} else {
-				cachePathList = append(cachePathList, path)
-			}
-
-			if _, err := os.Stat(path); err != nil {
-				if os.IsNotExist(err) {
-					os.Mkdir(path, os.ModeDir)
-				}
-			}
+	body, ok := p.render()
+	if !ok {
+		return
+	}
 
+	// a page of the request's CSRF token or user is not shared,
+	// the waiting and next requests render their own
+	if p.Ctx.noCache {
+		if f := p.Ctx.flight; f != nil {
+			p.Ctx.App().setUncached(f.key)
 		}
+		p.writePage(body, time.Time{})
+		return
+	}
 
-		p.savePageToFile(filename)
-		http.ServeFile(p.Ctx.ResponseWriter, p.Ctx.Request, filename)
+	modified := time.Now()
+	if f := p.Ctx.flight; f != nil {
+		p.Ctx.flight = nil
+		defer p.Ctx.App().finishFlight(f, body, modified)
+	}
+	store := p.Ctx.App().pageStore(p.Cache.Type)
+	if store != nil && p.cacheKey != "" {
+		c := &cachedPage{Key: p.cacheKey, Modified: modified, Body: body}
+		expire := time.Duration(p.Cache.Expire) * time.Second
+		if expire > 0 {
+			c.Expires = c.Modified.Add(expire)
+		}
+		store.Set(p.cacheKey, c.encode(), expire)
 	}
+
+	p.writePage(body, modified)
 }
 
 func (p *Page) savePageToFile(filename string) {
-	out, err := os.OpenFile(filename, os.O_TRUNC|os.O_CREATE, 0)
-	if err != nil {
-		log.App.Fatalln(err)
+	var buf bytes.Buffer
+	if err := p.BuildLayout().RenderLayout(&buf); err != nil {
+		log.App.Error(filename, err)
+		return
+	}
+	if err := writeFileAtomic(filename, buf.Bytes()); err != nil {
+		log.App.Error(filename, err)
 	}
-	p.BuildLayout().RenderLayout(out)
 }
 func (p *Page) ToStaticFile() {
-	p.savePageToFile(httpServer.WebRoot + "/" + p.View.GetPath() + ".html")
+	p.savePageToFile(p.Ctx.App().Config.WebRoot + "/" + p.View.GetPath() + ".html")
 }
 
 func (p *Page) BuildLayout() *AppLayout {
@@ -211,19 +301,24 @@ func (p *Page) BuildLayout() *AppLayout {
 
 	if len(p.Css) > 0 {
 		headLayout.CssRender = &CssRender{
-			Data: p.Css}
+			Data: p.Css,
+			app:  p.Ctx.App()}
 	}
 
 	if len(p.Js) > 0 {
 		headLayout.JsRender = &JsRender{
-			Data: p.Js}
+			Data: p.Js,
+			app:  p.Ctx.App()}
 	}
 	p.Layout.SetHeadLayout(headLayout)
 
 	if p.View != nil {
 		p.Layout.SetContextRender(&TemplateRender{
-			View: p.View,
-			Data: p.Data})
+			View:   p.View,
+			Layout: p.ViewLayout,
+			Data:   p.Data,
+			app:    p.Ctx.App(),
+			ctx:    p.Ctx})
 	}
 
 	return p.Layout
@@ -243,6 +338,9 @@ func (p *Page) SubDomain() string {
 func (p *Page) Init()   {}
 func (p *Page) Get()    {}
 func (p *Page) Post()   {}
+func (p *Page) Put()    {}
+func (p *Page) Patch()  {}
+func (p *Page) Delete() {}
 func (p *Page) Action() {}
 
 type ThemeItem struct {
@@ -263,16 +361,31 @@ func (th *ThemeItem) GetAssetsPath() string {
 	return "/themes/" + th.Theme + "/" + AssetsName + "/" + th.Folder + "/" + th.Value
 }
 
+// StaticFiles renders the pages by a GET / request and saves them by
+// ToStaticFile, see Export to render the routes of the app.
 func StaticFiles(pages []IPage) {
+	for _, p := range pages {
+		defaultApp.staticFile(p)
+	}
+}
+
+func (a *App) staticFile(p IPage) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.App.Emerg(err)
 		}
 	}()
 
-	for _, p := range pages {
-		v := reflect.ValueOf(p)
-		v.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(nil), v})
-		p.ToStaticFile()
+	ctx := &Context{ResponseWriter: &exportWriter{header: make(http.Header)}, Request: a.exportRequest("/"), app: a}
+	v := reflect.ValueOf(p)
+	if view := reflect.Indirect(v).FieldByName("View"); view.IsValid() && view.IsNil() {
+		v.MethodByName("SetView").Call([]reflect.Value{reflect.ValueOf(reflect.Indirect(v).Type().Name())})
+	}
+	v.MethodByName("Prepare").Call([]reflect.Value{reflect.ValueOf(ctx), v})
+	for _, name := range []string{"Init", "Get", "Action"} {
+		if isDie(v.MethodByName(name).Call(nil)) {
+			return
+		}
 	}
+	p.ToStaticFile()
 }
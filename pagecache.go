@@ -0,0 +1,516 @@
+package gos
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/jiorry/libs/cache"
+	"github.com/jiorry/libs/log"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageCacheStore keeps the pages rendered with a PageCache,
+// the store is chosen by PageCache.Type.
+type PageCacheStore interface {
+	Get(key string) ([]byte, bool)
+	// Set stores the page, expire is 0 for no expiry.
+	Set(key string, data []byte, expire time.Duration)
+	Delete(key string)
+	// Keys returns the keys of the stored pages, used by InvalidatePage.
+	Keys() []string
+}
+
+// cachedPage is the stored form of a page.
+type cachedPage struct {
+	Key      string
+	Modified time.Time
+	Expires  time.Time // zero for no expiry
+	Body     []byte
+}
+
+func (c *cachedPage) expired() bool {
+	return !c.Expires.IsZero() && time.Now().After(c.Expires)
+}
+
+func (c *cachedPage) encode() []byte {
+	b := make([]byte, 20, 20+len(c.Key)+len(c.Body))
+	binary.BigEndian.PutUint64(b, uint64(c.Modified.UnixNano()))
+	var expires int64
+	if !c.Expires.IsZero() {
+		expires = c.Expires.UnixNano()
+	}
+	binary.BigEndian.PutUint64(b[8:], uint64(expires))
+	binary.BigEndian.PutUint32(b[16:], uint32(len(c.Key)))
+	b = append(b, c.Key...)
+	return append(b, c.Body...)
+}
+
+func decodeCachedPage(b []byte) (*cachedPage, bool) {
+	if len(b) < 20 {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint32(b[16:]))
+	if len(b) < 20+n {
+		return nil, false
+	}
+	c := &cachedPage{
+		Key:      string(b[20 : 20+n]),
+		Modified: time.Unix(0, int64(binary.BigEndian.Uint64(b))),
+		Body:     b[20+n:]}
+	if expires := int64(binary.BigEndian.Uint64(b[8:])); expires != 0 {
+		c.Expires = time.Unix(0, expires)
+	}
+	return c, true
+}
+
+// SetPageCacheStore sets the store of PageCache.Type name, replacing the
+// default memory, file or cache store, or adding a new type.
+func SetPageCacheStore(name string, store PageCacheStore) {
+	defaultApp.SetPageCacheStore(name, store)
+}
+
+func (a *App) SetPageCacheStore(name string, store PageCacheStore) {
+	a.mu.Lock()
+	a.pageStores[name] = store
+	a.mu.Unlock()
+}
+
+// SetPageCacheKey sets the function building the cache key of a page.
+// The key must start with the request path, see InvalidatePage.
+// An empty key does not cache the page.
+func SetPageCacheKey(f func(ctx *Context) string) {
+	defaultApp.SetPageCacheKey(f)
+}
+
+func (a *App) SetPageCacheKey(f func(ctx *Context) string) {
+	a.pageCacheKey = f
+}
+
+var pageCacheTypes = []string{"memory", "file", "cache"}
+
+// pageStore returns the store of the cache type, nil for none.
+func (a *App) pageStore(typ string) PageCacheStore {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if store, ok := a.pageStores[typ]; ok {
+		return store
+	}
+	var store PageCacheStore
+	switch typ {
+	case "memory":
+		store = NewMemoryPageStore(a.Config.PageCacheSize)
+	case "file":
+		store = NewFilePageStore(a.Config.PageCacheDir)
+	case "cache":
+		store = NewLibsPageStore("page:")
+	default:
+		return nil
+	}
+	a.pageStores[typ] = store
+	return store
+}
+
+// PageCacheKey is the default cache key: the path, the sorted query
+// and the user group. The pages of the logged users
+// are cached by group only when AuthVO.FieldGroup is set, they are not
+// cached otherwise.
+func PageCacheKey(ctx *Context) string {
+	group, ok := userGroup(ctx)
+	if !ok {
+		return ""
+	}
+
+	req := ctx.Request
+	key := req.URL.Path
+	if query := req.URL.Query(); len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+	return key + "|g=" + group
+}
+
+// userGroup returns the group column of the logged user, guest for the
+// others. It returns false for a logged user without group.
+func userGroup(ctx *Context) (string, bool) {
+	auth := ctx.userAuth()
+	if _, err := ctx.Request.Cookie(auth.VO.CookieKey); err != nil || auth.NotOk() {
+		return "guest", true
+	}
+	if auth.VO.FieldGroup == "" {
+		return "", false
+	}
+	group, ok := auth.CurrentUser()[auth.VO.FieldGroup]
+	if !ok || group == nil {
+		return "", false
+	}
+	return "u" + fmt.Sprint(group), true
+}
+
+func (a *App) cacheKey(ctx *Context) string {
+	if a.pageCacheKey != nil {
+		return a.pageCacheKey(ctx)
+	}
+	return PageCacheKey(ctx)
+}
+
+func getCachedPage(store PageCacheStore, key string) (*cachedPage, bool) {
+	b, ok := store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	c, ok := decodeCachedPage(b)
+	if !ok || c.Key != key {
+		return nil, false
+	}
+	if c.expired() {
+		store.Delete(key)
+		return nil, false
+	}
+	return c, true
+}
+
+// InvalidatePage removes the cached pages whose path matches the pattern,
+// * matching any characters: InvalidatePage("/product/42"),
+// InvalidatePage("/product/*"). It returns the number of removed pages.
+func InvalidatePage(pattern string) int {
+	return defaultApp.InvalidatePage(pattern)
+}
+
+func (a *App) InvalidatePage(pattern string) int {
+	reg := regexp.MustCompile("^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$")
+
+	// the default stores are created lazily, a file cache has pages
+	// stored before a restart
+	for _, typ := range pageCacheTypes {
+		a.pageStore(typ)
+	}
+	a.mu.Lock()
+	stores := make([]PageCacheStore, 0, len(a.pageStores))
+	for _, store := range a.pageStores {
+		stores = append(stores, store)
+	}
+	a.mu.Unlock()
+
+	n := 0
+	for _, store := range stores {
+		for _, key := range store.Keys() {
+			p := key
+			if i := strings.IndexAny(p, "?|"); i != -1 {
+				p = p[:i]
+			}
+			if reg.MatchString(p) {
+				store.Delete(key)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// pageFlight is the rendering of a missing page, the concurrent requests
+// of the same page wait for it instead of rendering the page again.
+type pageFlight struct {
+	key      string
+	done     chan bool
+	body     []byte // nil when the page was not rendered
+	modified time.Time
+}
+
+// joinFlight returns the flight of key, leader is true when the caller
+// has to render the page and finish the flight.
+func (a *App) joinFlight(key string) (f *pageFlight, leader bool) {
+	a.flightMu.Lock()
+	defer a.flightMu.Unlock()
+
+	if f, ok := a.flights[key]; ok {
+		return f, false
+	}
+	f = &pageFlight{key: key, done: make(chan bool)}
+	a.flights[key] = f
+	return f, true
+}
+
+// maxUncached bounds the keys remembered by setUncached.
+const maxUncached = 10000
+
+// isUncached reports whether the page of the flight key is rendered for
+// each request, see Context.noCache. Its requests do not wait for a flight.
+func (a *App) isUncached(key string) bool {
+	a.flightMu.Lock()
+	defer a.flightMu.Unlock()
+	return a.uncached[key]
+}
+
+func (a *App) setUncached(key string) {
+	a.flightMu.Lock()
+	if len(a.uncached) >= maxUncached {
+		a.uncached = make(map[string]bool)
+	}
+	a.uncached[key] = true
+	a.flightMu.Unlock()
+}
+
+// finishFlight shares the page with the waiting requests.
+func (a *App) finishFlight(f *pageFlight, body []byte, modified time.Time) {
+	a.flightMu.Lock()
+	if a.flights[f.key] == f {
+		delete(a.flights, f.key)
+	}
+	a.flightMu.Unlock()
+
+	f.body, f.modified = body, modified
+	close(f.done)
+}
+
+// MemoryPageStore keeps the pages in memory, the least recently used
+// are dropped when it is full.
+type MemoryPageStore struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type memoryPage struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func NewMemoryPageStore(size int) *MemoryPageStore {
+	return &MemoryPageStore{size: size, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (s *MemoryPageStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := e.Value.(*memoryPage)
+	if !item.expires.IsZero() && time.Now().After(item.expires) {
+		s.lru.Remove(e)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return item.data, true
+}
+
+func (s *MemoryPageStore) Set(key string, data []byte, expire time.Duration) {
+	item := &memoryPage{key: key, data: data}
+	if expire > 0 {
+		item.expires = time.Now().Add(expire)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		e.Value = item
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.items[key] = s.lru.PushFront(item)
+	for s.size > 0 && s.lru.Len() > s.size {
+		e := s.lru.Back()
+		s.lru.Remove(e)
+		delete(s.items, e.Value.(*memoryPage).key)
+	}
+}
+
+func (s *MemoryPageStore) Delete(key string) {
+	s.mu.Lock()
+	if e, ok := s.items[key]; ok {
+		s.lru.Remove(e)
+		delete(s.items, key)
+	}
+	s.mu.Unlock()
+}
+
+func (s *MemoryPageStore) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.items))
+	for k, e := range s.items {
+		if expires := e.Value.(*memoryPage).expires; !expires.IsZero() && now.After(expires) {
+			s.lru.Remove(e)
+			delete(s.items, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// FilePageStore keeps the pages in files of dir named by the hash of the key.
+type FilePageStore struct {
+	dir string
+}
+
+func NewFilePageStore(dir string) *FilePageStore {
+	return &FilePageStore{dir: dir}
+}
+
+func (s *FilePageStore) filename(key string) string {
+	name := hashKey(key)
+	return filepath.Join(s.dir, name[:2], name+".page")
+}
+
+func (s *FilePageStore) Get(key string) ([]byte, bool) {
+	b, err := os.ReadFile(s.filename(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Set ignores expire, the expiry is stored in the page.
+func (s *FilePageStore) Set(key string, data []byte, expire time.Duration) {
+	filename := s.filename(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.App.Error("page cache:", err)
+		return
+	}
+	if err := writeFileAtomic(filename, data); err != nil {
+		log.App.Error("page cache:", err)
+	}
+}
+
+// writeFileAtomic writes a temporary file renamed to filename,
+// so the readers never see a partial file.
+func writeFileAtomic(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (s *FilePageStore) Delete(key string) {
+	os.Remove(s.filename(key))
+}
+
+func (s *FilePageStore) Keys() []string {
+	keys := make([]string, 0)
+	filepath.Walk(s.dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(filename, ".page") {
+			return nil
+		}
+		if key, ok := readPageKey(filename); ok {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// readPageKey reads the key in the header of a cached page file,
+// not the whole page.
+func readPageKey(filename string) (string, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	head := make([]byte, 20)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return "", false
+	}
+	key := make([]byte, binary.BigEndian.Uint32(head[16:]))
+	if _, err := io.ReadFull(f, key); err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// LibsPageStore keeps the pages in libs/cache, e.g. redis.
+// Keys only knows the pages stored by this process.
+type LibsPageStore struct {
+	prefix string
+	mu     sync.Mutex
+	keys   map[string]time.Time // key => expires
+}
+
+func NewLibsPageStore(prefix string) *LibsPageStore {
+	return &LibsPageStore{prefix: prefix, keys: make(map[string]time.Time)}
+}
+
+func (s *LibsPageStore) Get(key string) ([]byte, bool) {
+	b, err := cache.Get(s.prefix + hashKey(key))
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	return b, true
+}
+
+func (s *LibsPageStore) Set(key string, data []byte, expire time.Duration) {
+	if err := cache.Set(s.prefix+hashKey(key), data, int64(expire/time.Second)); err != nil {
+		log.App.Error("page cache:", err)
+		return
+	}
+
+	var expires time.Time
+	if expire > 0 {
+		expires = time.Now().Add(expire)
+	}
+	s.mu.Lock()
+	s.keys[key] = expires
+	s.mu.Unlock()
+}
+
+func (s *LibsPageStore) Delete(key string) {
+	cache.Delete(s.prefix + hashKey(key))
+	s.mu.Lock()
+	delete(s.keys, key)
+	s.mu.Unlock()
+}
+
+func (s *LibsPageStore) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.keys))
+	for k, expires := range s.keys {
+		if !expires.IsZero() && now.After(expires) {
+			delete(s.keys, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
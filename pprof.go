@@ -1,8 +1,13 @@
 package gos
 
 import (
+	"crypto/subtle"
+	"errors"
+	"github.com/jiorry/libs/log"
+	"net"
 	"net/http"
 	"net/http/pprof"
+	"strings"
 )
 
 func pprofDefaultHander(rw http.ResponseWriter, req *http.Request) {
@@ -20,3 +25,134 @@ func pprofCmdlineHander(rw http.ResponseWriter, req *http.Request) {
 func pprofSymbolHander(rw http.ResponseWriter, req *http.Request) {
 	pprof.Symbol(rw, req)
 }
+
+func pprofTraceHander(rw http.ResponseWriter, req *http.Request) {
+	pprof.Trace(rw, req)
+}
+
+// checkPprof returns the path prefix of pprof. pprof is served on the app
+// port only when PprofAllow or PprofUser is set, behind a local proxy
+// every client is a loopback one.
+func (a *App) checkPprof() (string, error) {
+	prefix := strings.TrimSuffix(a.Config.PprofPath, "/")
+	if !strings.HasPrefix(prefix, "/") {
+		return "", errors.New("pprof_path must be a path like /debug/pprof: " + a.Config.PprofPath)
+	}
+	if a.Config.PprofAddr == "" && a.Config.PprofUser == "" && len(pprofAllowList(a.Config.PprofAllow)) == 0 {
+		return "", errors.New("pprof on the app port needs pprof_allow or pprof_user, or its own pprof_addr")
+	}
+	return prefix, nil
+}
+
+// pprofHandler serves index, profile, heap, goroutine, trace, symbol, cmdline
+// and the other runtime profiles under prefix.
+func (a *App) pprofHandler(prefix string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/", func(rw http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, prefix+"/")
+		if name == "" {
+			pprofDefaultHander(rw, req)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(rw, req)
+	})
+	mux.HandleFunc(prefix+"/profile", pprofProfileHander)
+	mux.HandleFunc(prefix+"/cmdline", pprofCmdlineHander)
+	mux.HandleFunc(prefix+"/symbol", pprofSymbolHander)
+	mux.HandleFunc(prefix+"/trace", pprofTraceHander)
+	mux.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+
+	return a.pprofGuard(mux)
+}
+
+func pprofAllowList(list []string) []*net.IPNet {
+	allow := make([]*net.IPNet, 0, len(list))
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if strings.Contains(v, ":") {
+				v += "/128"
+			} else {
+				v += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(v)
+		if err != nil {
+			log.App.Alert("pprof_allow: ", err)
+			continue
+		}
+		allow = append(allow, ipnet)
+	}
+	return allow
+}
+
+// pprofGuard checks the client ip against PprofAllow and the basic auth
+// against PprofUser and PprofPassword. Without any of them set only
+// loopback clients are allowed, see checkPprof.
+func (a *App) pprofGuard(h http.Handler) http.Handler {
+	allow := pprofAllowList(a.Config.PprofAllow)
+	user, password := a.Config.PprofUser, a.Config.PprofPassword
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+
+		if len(allow) > 0 {
+			ok := false
+			for _, ipnet := range allow {
+				if ip != nil && ipnet.Contains(ip) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				http.Error(rw, "Forbidden", 403)
+				return
+			}
+		} else if user == "" && (ip == nil || !ip.IsLoopback()) {
+			http.Error(rw, "Forbidden", 403)
+			return
+		}
+
+		if user != "" {
+			u, p, ok := req.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+				rw.Header().Set("WWW-Authenticate", `Basic realm="pprof"`)
+				http.Error(rw, "Unauthorized", 401)
+				return
+			}
+		}
+
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// startPprof serves pprof on its own admin listener PprofAddr.
+func (a *App) startPprof() {
+	prefix, err := a.checkPprof()
+	if err != nil {
+		log.App.Error("pprof:", err)
+		return
+	}
+	l, err := net.Listen("tcp", a.Config.PprofAddr)
+	if err != nil {
+		log.App.Error("pprof:", err)
+		return
+	}
+
+	server := &http.Server{Handler: a.pprofHandler(prefix)}
+	a.serving(nil, server)
+	log.App.Write("pprof start at ", a.Config.PprofAddr, a.Config.PprofPath)
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.App.Error("pprof:", err)
+		}
+	}()
+}
@@ -0,0 +1,201 @@
+package gos
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jiorry/libs/log"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// recover catches the panics of the handlers. The stack is logged and the
+// client gets 500, with a detailed error page when RunMode is "dev".
+func (a *App) recover(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			a.internalError(rw, req, err, debug.Stack())
+		}()
+
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// internalError logs err and writes 500.
+func (a *App) internalError(rw http.ResponseWriter, req *http.Request, err interface{}, stack []byte) {
+	info := requestInfoOf(req)
+	if stack != nil {
+		log.App.Error("rid="+info.RequestId, "panic:", err, req.Method, req.URL.String(), "\n"+string(stack))
+	} else {
+		log.App.Error("rid="+info.RequestId, err, req.Method, req.URL.String())
+	}
+
+	if sw, ok := rw.(*statusWriter); ok && sw.status != 0 {
+		// the response is already started
+		return
+	}
+
+	header := rw.Header()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	if a.runMode() != "dev" {
+		a.serveError(rw, req, 500, "")
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/api/") {
+		a.serveError(rw, req, 500, fmt.Sprint(err))
+		return
+	}
+
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(500)
+	devErrorTemplate.Execute(rw, newDevError(a.FS(), err, stack, req, info))
+}
+
+type devErrorLine struct {
+	Num     int
+	Text    string
+	Current bool
+}
+
+type devError struct {
+	Message   string
+	Stack     string
+	RequestId string
+	Method    string
+	URL       string
+	Proto     string
+	Remote    string
+	Header    [][2]string
+	Form      [][2]string
+	Handler   string
+	Route     string
+	Params    [][2]string
+	File      string
+	Line      int
+	Source    []devErrorLine
+}
+
+func newDevError(fsys fs.FS, err interface{}, stack []byte, req *http.Request, info *requestInfo) *devError {
+	d := &devError{
+		Message:   fmt.Sprint(err),
+		Stack:     string(stack),
+		RequestId: info.RequestId,
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		Proto:     req.Proto,
+		Remote:    req.RemoteAddr,
+		Handler:   info.Handler,
+		Route:     info.Route,
+	}
+
+	for k, v := range req.Header {
+		d.Header = append(d.Header, [2]string{k, strings.Join(v, ", ")})
+	}
+	for k, v := range req.Form {
+		d.Form = append(d.Form, [2]string{k, strings.Join(v, ", ")})
+	}
+	for k, v := range info.Params {
+		d.Params = append(d.Params, [2]string{k, v})
+	}
+	sortPairs(d.Header)
+	sortPairs(d.Form)
+	sortPairs(d.Params)
+
+	if terr, ok := err.(*TemplateError); ok {
+		d.File = terr.File
+		d.Line = terr.Line()
+		d.Source = sourceLines(fsys, terr.File, d.Line, 5)
+	}
+	return d
+}
+
+func sortPairs(pairs [][2]string) {
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+}
+
+// sourceLines returns the lines of the file around line.
+func sourceLines(fsys fs.FS, filename string, line, around int) []devErrorLine {
+	if line <= 0 {
+		return nil
+	}
+	f, err := fsys.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []devErrorLine
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan() && n <= line+around; n++ {
+		if n >= line-around {
+			lines = append(lines, devErrorLine{Num: n, Text: scanner.Text(), Current: n == line})
+		}
+	}
+	return lines
+}
+
+var devErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>500 {{.Message}}</title>
+<style>
+body{font:14px/1.5 sans-serif;margin:0;color:#222}
+h1{margin:0;padding:20px;background:#b71c1c;color:#fff;font-size:20px;word-wrap:break-word}
+h2{font-size:16px;margin:24px 0 8px}
+section{padding:0 20px}
+pre{background:#f5f5f5;padding:10px;overflow:auto;font:12px/1.5 monospace}
+table{border-collapse:collapse}
+td{padding:2px 12px 2px 0;vertical-align:top;font-family:monospace}
+td:first-child{color:#666}
+.current{background:#ffcdd2}
+</style>
+</head>
+<body>
+<h1>{{.Message}}</h1>
+{{if .File}}<section>
+<h2>Template {{.File}}{{if .Line}}:{{.Line}}{{end}}</h2>
+{{if .Source}}<pre>{{range .Source}}<span{{if .Current}} class="current"{{end}}>{{printf "%4d" .Num}}  {{.Text}}</span>
+{{end}}</pre>{{end}}
+</section>{{end}}
+<section>
+<h2>Route</h2>
+<table>
+<tr><td>handler</td><td>{{.Handler}}</td></tr>
+<tr><td>rule</td><td>{{.Route}}</td></tr>
+{{range .Params}}<tr><td>:{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>
+</section>
+<section>
+<h2>Request</h2>
+<table>
+<tr><td>id</td><td>{{.RequestId}}</td></tr>
+<tr><td>method</td><td>{{.Method}} {{.Proto}}</td></tr>
+<tr><td>url</td><td>{{.URL}}</td></tr>
+<tr><td>remote</td><td>{{.Remote}}</td></tr>
+{{range .Header}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Form}}<h2>Form</h2>
+<table>
+{{range .Form}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>{{end}}
+</section>
+{{if .Stack}}<section>
+<h2>Stack</h2>
+<pre>{{.Stack}}</pre>
+</section>{{end}}
+</body>
+</html>
+`))
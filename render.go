@@ -1,45 +1,95 @@
 package gos
 
 import (
-	"html/template"
 	"io"
+	"regexp"
+	"strconv"
 )
 
 var (
 	b_JS_TAG_BEGIN  = []byte("<script src=\"")
-	b_JS_TAG_END    = []byte("\"></script>\n")
+	b_JS_TAG_END    = []byte("></script>\n")
 	b_CSS_TAG_BEGIN = []byte("<link href=\"")
-	b_CSS_TAG_END   = []byte("\" rel=\"stylesheet\"/>\n")
+	b_CSS_TAG_END   = []byte(" rel=\"stylesheet\"/>\n")
+	b_INTEGRITY     = []byte(" integrity=\"")
+	b_CROSSORIGIN   = []byte("\" crossorigin=\"anonymous\"")
 )
 
 type IRender interface {
 	Render(io.Writer)
 }
 
+// IRenderErr is an IRender reporting its errors, the layouts render it
+// by RenderErr and stop at the first error.
+type IRenderErr interface {
+	IRender
+	RenderErr(io.Writer) error
+}
+
+// render runs r by RenderErr when it has it.
+func render(r IRender, w io.Writer) error {
+	if re, ok := r.(IRenderErr); ok {
+		return re.RenderErr(w)
+	}
+	r.Render(w)
+	return nil
+}
+
 // EmptyRender
 type EmptyRender struct{}
 
-func (this *EmptyRender) Render(w io.Writer) {}
+func (this *EmptyRender) Render(w io.Writer)          {}
+func (this *EmptyRender) RenderErr(w io.Writer) error { return nil }
 
-// TemplateRender
+// TemplateRender renders the View, by the Layout template when it is set.
+// See App.parseTemplate for the partials and layouts.
 type TemplateRender struct {
-	View *ThemeItem
-	Data interface{}
+	View   *ThemeItem
+	Layout string
+	Data   interface{}
+	app    *App
+	ctx    *Context
 }
 
+// Render panics on a template error, see RenderErr.
 func (this *TemplateRender) Render(w io.Writer) {
-	defer func() {
-		if err := recover(); err != nil {
-			panic("template not found: " + httpServer.WebRoot + this.View.GetPath() + ".htm")
-		}
-	}()
-	filepath := httpServer.WebRoot + this.View.GetPath() + ".htm"
+	if err := this.RenderErr(w); err != nil {
+		panic(err)
+	}
+}
 
-	tmpl, _ := template.ParseFiles(filepath)
-	err := tmpl.Execute(w, this.Data)
+func (this *TemplateRender) RenderErr(w io.Writer) error {
+	c, err := appOrDefault(this.app).template(this.View, this.Layout)
 	if err != nil {
-		panic("template execute error: " + filepath)
+		return err
+	}
+	if this.ctx == nil {
+		return c.execute(w, this.Data, nil)
 	}
+	return c.execute(w, this.Data, requestFuncs(this.ctx))
+}
+
+// TemplateError is returned when a template fails to parse or execute.
+type TemplateError struct {
+	File string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return "template " + e.File + ": " + e.Err.Error()
+}
+
+var templateLineReg = regexp.MustCompile(`template: ([^:]+):(\d+)`)
+
+// Line returns the line of the template reported by the parser
+// or the executor, 0 if unknown.
+func (e *TemplateError) Line() int {
+	m := templateLineReg.FindStringSubmatch(e.Err.Error())
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[2])
+	return n
 }
 
 // HeadRender
@@ -48,23 +98,36 @@ type HeadItemRender struct {
 }
 
 func (this *HeadItemRender) Render(w io.Writer) {
+	this.RenderErr(w)
+}
+
+func (this *HeadItemRender) RenderErr(w io.Writer) error {
 	for _, v := range this.Data {
-		w.Write([]byte(v + "\n"))
+		if _, err := w.Write([]byte(v + "\n")); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // JsRender
 type JsRender struct {
 	Data []*ThemeItem
+	app  *App
 }
 
 func (this *JsRender) Render(w io.Writer) {
-	for _, v := range this.Data {
+	this.RenderErr(w)
+}
+
+func (this *JsRender) RenderErr(w io.Writer) error {
+	for _, v := range appOrDefault(this.app).assetRefs(this.Data, ".js") {
 		w.Write(b_JS_TAG_BEGIN)
-		w.Write([]byte(StaticUrl + v.GetAssetsPath() + httpServer.Timestamp))
+		w.Write([]byte(v.url))
 		w.Write(B_QUOTE)
-		if v.Data != nil {
-			for k, val := range v.Data {
+		writeIntegrity(w, v.integrity)
+		if v.data != nil {
+			for k, val := range v.data {
 				w.Write(B_SPACE)
 				w.Write([]byte(k))
 				w.Write(B_EQUAL)
@@ -75,30 +138,63 @@ func (this *JsRender) Render(w io.Writer) {
 		}
 		w.Write(b_JS_TAG_END)
 	}
+	return nil
 }
 
 // CssRender
 type CssRender struct {
 	Data []*ThemeItem
+	app  *App
 }
 
 func (this *CssRender) Render(w io.Writer) {
-	for _, v := range this.Data {
+	this.RenderErr(w)
+}
+
+func (this *CssRender) RenderErr(w io.Writer) error {
+	for _, v := range appOrDefault(this.app).assetRefs(this.Data, ".css") {
 		w.Write(b_CSS_TAG_BEGIN)
-		w.Write([]byte(StaticUrl + v.GetAssetsPath() + httpServer.Timestamp))
+		w.Write([]byte(v.url))
+		w.Write(B_QUOTE)
+		writeIntegrity(w, v.integrity)
 		w.Write(b_CSS_TAG_END)
 	}
+	return nil
 }
 
-// TextRender
+func writeIntegrity(w io.Writer, integrity string) {
+	if integrity != "" {
+		w.Write(b_INTEGRITY)
+		w.Write([]byte(integrity))
+		w.Write(b_CROSSORIGIN)
+	}
+}
+
+// TextRender renders Source with the funcs of the app, see App.NewTextRender,
+// or of the default app.
 type TextRender struct {
 	Name   string
 	Source string
 	Data   map[string]interface{}
+	app    *App
+}
+
+func (a *App) NewTextRender(name, source string, data map[string]interface{}) *TextRender {
+	return &TextRender{Name: name, Source: source, Data: data, app: a}
 }
 
+// Render panics on a template error, see RenderErr.
 func (this *TextRender) Render(w io.Writer) {
+	if err := this.RenderErr(w); err != nil {
+		panic(err)
+	}
+}
 
-	tmpl, _ := template.New(this.Name).Parse(this.Source)
-	tmpl.Execute(w, this.Data)
+// RenderErr parses Source once by app, name and source.
+func (this *TextRender) RenderErr(w io.Writer) error {
+	tmpl, err := appOrDefault(this.app).textTemplate(this.Name, this.Source)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, this.Data)
 }
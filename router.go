@@ -1,35 +1,231 @@
 package gos
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"github.com/jiorry/gos/websock"
 	"github.com/jiorry/libs/log"
-	"html"
+	"net/url"
 	"reflect"
 	"regexp"
+	"runtime"
 	"strings"
 )
 
-var routes []*Route = make([]*Route, 0)
-var apiRoutes []*Route = make([]*Route, 0)
-var upRoutes []*Route = make([]*Route, 0)
-var wsRoutes []*Route = make([]*Route, 0)
-
 type Route struct {
+	app           *App
 	ClassType     reflect.Type
 	Rule          []byte
-	Pattern       *regexp.Regexp // for matching the url path
 	Keys          []string
+	methods       []string
 	beforeFilters []func(ctx *Context) bool
 	afterFilters  []func(ctx *Context) bool
+	staticParams  func() []map[string]string
+	wsServer      *websock.Server // server of a websocket route
+	segments      []ruleSegment
+
+	// Deprecated: the routes are matched by a tree, Pattern matching the
+	// whole path is kept for compatibility. It is nil for static rules.
+	Pattern *regexp.Regexp
 }
 
 type RouteMatched struct {
+	Route     *Route
 	ClassType reflect.Type
 	Params    map[string]string
 }
 
+// Name names the route for URLFor.
+func (r *Route) Name(name string) *Route {
+	if old, ok := r.app.namedRoutes[name]; ok {
+		log.App.Alert("route name " + name + " is used by " + string(old.Rule))
+	}
+	r.app.namedRoutes[name] = r
+	return r
+}
+
+// URLFor builds the url of the named route. The args are key value pairs
+// filling the route parameters, the others are appended as query string.
+// URLFor("product.show", "id", 42) returns HomeUrl + "/product/42"
+// for the route /product/:id<int>.
+// In templates it is the url function: {{url "product.show" "id" .Id}}
+func URLFor(name string, args ...interface{}) (string, error) {
+	return defaultApp.URLFor(name, args...)
+}
+
+func (a *App) URLFor(name string, args ...interface{}) (string, error) {
+	r, ok := a.namedRoutes[name]
+	if !ok {
+		return "", errors.New("route not found: " + name)
+	}
+	path, err := r.path(name, args)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(a.homeUrl(), "/") + path, nil
+}
+
+// path fills the route parameters by the key value pairs of args.
+func (r *Route) path(name string, args []interface{}) (string, error) {
+	if len(args)%2 != 0 {
+		return "", errors.New("route " + name + ": args must be key value pairs")
+	}
+
+	values := make(map[string]string, len(args)/2)
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		k := fmt.Sprint(args[i])
+		values[k] = fmt.Sprint(args[i+1])
+		keys = append(keys, k)
+	}
+
+	path := ""
+	for _, seg := range r.segments {
+		if seg.key == "" {
+			path += "/" + seg.static
+			continue
+		}
+
+		v, ok := values[seg.key]
+		delete(values, seg.key)
+		if !ok {
+			if seg.optional {
+				continue
+			}
+			return "", errors.New("route " + name + ": missing parameter " + seg.key)
+		}
+
+		if seg.catchAll {
+			parts := splitPath(v)
+			for i := range parts {
+				parts[i] = url.PathEscape(parts[i])
+			}
+			if len(parts) > 0 {
+				path += "/" + strings.Join(parts, "/")
+			}
+			continue
+		}
+
+		if !seg.pattern.MatchString(v) {
+			return "", errors.New("route " + name + ": invalid parameter " + seg.key + "=" + v)
+		}
+		path += "/" + seg.prefix + url.PathEscape(v) + seg.suffix
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	if len(values) > 0 {
+		query := url.Values{}
+		for _, k := range keys {
+			if v, ok := values[k]; ok {
+				query.Add(k, v)
+			}
+		}
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+// Methods limits the HTTP methods the route accepts, e.g.
+// AddRoute("/admin/product/:id", (*ProductPage)(nil)).Methods("GET", "PUT", "DELETE")
+// A page route accepts GET, POST and the methods of the hooks its type
+// overrides (Put, Patch, Delete) unless Methods is called.
+// HEAD is accepted whenever GET is, and OPTIONS is always answered with the Allow header.
+// Requests with any other method get 405 Method Not Allowed.
+func (r *Route) Methods(methods ...string) *Route {
+	r.methods = make([]string, 0, len(methods))
+	for _, m := range methods {
+		r.methods = append(r.methods, strings.ToUpper(m))
+	}
+	return r
+}
+
+// AllowedMethods returns the methods accepted by the route.
+func (r *Route) AllowedMethods() []string {
+	if len(r.methods) == 0 {
+		return httpMethods
+	}
+
+	allowed := make([]string, 0, len(r.methods)+2)
+	for _, m := range httpMethods {
+		switch m {
+		case "HEAD":
+			if r.IsAllowed("GET") {
+				allowed = append(allowed, m)
+			}
+		case "OPTIONS":
+			allowed = append(allowed, m)
+		default:
+			if r.IsAllowed(m) {
+				allowed = append(allowed, m)
+			}
+		}
+	}
+	return allowed
+}
+
+// Before adds filters which run before the page Init.
+// A filter returning false stops the request.
+func (r *Route) Before(filters ...func(ctx *Context) bool) *Route {
+	r.beforeFilters = append(r.beforeFilters, filters...)
+	return r
+}
+
+// After adds filters which run after the response is rendered.
+// A filter returning false stops the remaining after filters.
+func (r *Route) After(filters ...func(ctx *Context) bool) *Route {
+	r.afterFilters = append(r.afterFilters, filters...)
+	return r
+}
+
+func (r *Route) runBeforeFilters(ctx *Context) bool {
+	return runFilters(r.beforeFilters, ctx)
+}
+
+func (r *Route) runAfterFilters(ctx *Context) bool {
+	return runFilters(r.afterFilters, ctx)
+}
+
+func runFilters(filters []func(ctx *Context) bool, ctx *Context) bool {
+	for _, f := range filters {
+		if !f(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Route) IsAllowed(method string) bool {
+	if len(r.methods) == 0 || method == "OPTIONS" {
+		return true
+	}
+	if method == "HEAD" {
+		method = "GET"
+	}
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRoute registers a page route. The rule may contain
+//
+//	:name           a parameter matching \w+
+//	:name<int>      a typed parameter, see routeParamTypes
+//	:name<[a-z-]+>  a parameter constrained by a regular expression
+//	*name           a catch-all matching the rest of the path
+//
+// and a segment ending with ? is optional, e.g. /list/:page<int>?
+// The matched values are available by Context.RouterParam.
 func AddRoute(rule string, clas interface{}) *Route {
+	return defaultApp.AddRoute(rule, clas)
+}
+
+func (a *App) AddRoute(rule string, clas interface{}) *Route {
 	switch rule {
 	case "/upload":
 		log.App.Alert("/upload is used for default upload router")
@@ -40,62 +236,74 @@ func AddRoute(rule string, clas interface{}) *Route {
 	case "/ws":
 		log.App.Alert("/ws is used for default websocket router")
 	}
-	return addRouteTo(rule, clas, 0)
+	return a.addRouteTo(rule, clas, 0)
 }
 
 func MatchRoute(path []byte) *RouteMatched {
-	return matchRoute(path, 0)
+	return defaultApp.MatchRoute(path)
+}
+
+func (a *App) MatchRoute(path []byte) *RouteMatched {
+	return a.matchRoute(path, 0)
 }
 
-func AddWebSocketRoute(rule string, clas interface{}) {
-	httpServer.EnableWebSocket = true
-	r := addRouteTo("/ws"+rule, clas, 3)
-	s := websock.NewServer(r.ClassType.String())
-	go s.Start()
+func AddWebSocketRoute(rule string, clas interface{}) *Route {
+	return defaultApp.AddWebSocketRoute(rule, clas)
+}
+
+func (a *App) AddWebSocketRoute(rule string, clas interface{}) *Route {
+	a.Config.EnableWebSocket = true
+	r := a.addRouteTo("/ws"+rule, clas, 3)
+	r.wsServer = websock.New()
+	go r.wsServer.Start()
+	return r
 }
 
 func MatchWebSocketRoute(path []byte) *RouteMatched {
-	return searchPathFrom(path, wsRoutes)
+	return defaultApp.MatchWebSocketRoute(path)
 }
 
-func AddWebApiRoute(rule string, clas interface{}) {
-	httpServer.EnableApi = true
-	addRouteTo("/api"+rule, clas, 1)
+func (a *App) MatchWebSocketRoute(path []byte) *RouteMatched {
+	return a.matchRoute(path, 3)
+}
+
+func AddWebApiRoute(rule string, clas interface{}) *Route {
+	return defaultApp.AddWebApiRoute(rule, clas)
+}
+
+func (a *App) AddWebApiRoute(rule string, clas interface{}) *Route {
+	a.Config.EnableApi = true
+	return a.addRouteTo("/api"+rule, clas, 1)
 }
 
 func MatchWebApiRoute(path []byte) *RouteMatched {
-	return searchPathFrom(path, apiRoutes)
+	return defaultApp.MatchWebApiRoute(path)
 }
 
-func AddFileUploadRoute(rule string, clas interface{}) {
-	httpServer.EnableUpload = true
-	addRouteTo("/upload"+rule, clas, 2)
+func (a *App) MatchWebApiRoute(path []byte) *RouteMatched {
+	return a.matchRoute(path, 1)
 }
 
-func MatchFileuploadRoute(path []byte) *RouteMatched {
-	return searchPathFrom(path, upRoutes)
+func AddFileUploadRoute(rule string, clas interface{}) *Route {
+	return defaultApp.AddFileUploadRoute(rule, clas)
 }
 
-func addRouteTo(rule string, clas interface{}, itype int) *Route {
-	var regPath *regexp.Regexp
-	var keys []string
+func (a *App) AddFileUploadRoute(rule string, clas interface{}) *Route {
+	a.Config.EnableUpload = true
+	return a.addRouteTo("/upload"+rule, clas, 2)
+}
 
-	if strings.ContainsAny(rule, ":") {
-		regReplace, _ := regexp.Compile(":\\w+")
-		matched := regReplace.FindAllString(rule, -1)
-		// prepare keys
-		keys = []string{}
-		for _, value := range matched {
-			keys = append(keys, value[1:len(value)])
-		}
+func MatchFileuploadRoute(path []byte) *RouteMatched {
+	return defaultApp.MatchFileuploadRoute(path)
+}
 
-		//prepare regexp pattern
-		p := regReplace.ReplaceAllString("^"+rule+"$", "(\\w+)")
-		regPath, _ = regexp.Compile(p)
-	} else {
-		if strings.HasSuffix(rule, "/") {
-			rule = strings.TrimSuffix(rule, "/")
-		}
+func (a *App) MatchFileuploadRoute(path []byte) *RouteMatched {
+	return a.matchRoute(path, 2)
+}
+
+func (a *App) addRouteTo(rule string, clas interface{}, itype int) *Route {
+	if len(rule) > 1 && strings.HasSuffix(rule, "/") {
+		rule = strings.TrimSuffix(rule, "/")
 	}
 
 	//prepare class struct
@@ -104,68 +312,115 @@ func addRouteTo(rule string, clas interface{}, itype int) *Route {
 		typ = typ.Elem()
 	}
 
+	segs := parseRule(rule)
 	r := &Route{
-		Keys:      keys,
+		app:       a,
+		Keys:      ruleKeys(segs),
 		Rule:      []byte(rule),
-		Pattern:   regPath,
+		Pattern:   rulePattern(segs),
+		segments:  segs,
 		ClassType: typ}
-	switch itype {
-	case 0:
-		routes = append(routes, r)
-	case 1:
-		apiRoutes = append(apiRoutes, r)
-	case 2:
-		upRoutes = append(upRoutes, r)
-	case 3:
-		wsRoutes = append(wsRoutes, r)
+	if itype == 0 {
+		r.methods = pageMethods(typ)
 	}
+	a.routeTableOf(itype).add(r)
 	return r
 }
 
-func searchPathFrom(path []byte, fromRoutes []*Route) *RouteMatched {
-	if bytes.HasSuffix(path, B_SLASH) {
-		path = bytes.TrimSuffix(path, B_SLASH)
+// rulePattern returns the regular expression of a rule with parameters.
+func rulePattern(segs []ruleSegment) *regexp.Regexp {
+	if len(ruleKeys(segs)) == 0 {
+		return nil
 	}
-	for _, route := range fromRoutes {
-		if bytes.Equal(path, route.Rule) {
-			return &RouteMatched{ClassType: route.ClassType, Params: nil}
+
+	expr := ""
+	for _, seg := range segs {
+		part := regexp.QuoteMeta(seg.static)
+		if seg.catchAll {
+			part = "(.*)"
+		} else if seg.key != "" {
+			part = regexp.QuoteMeta(seg.prefix) + "(" + paramExpr(seg.typ) + ")" + regexp.QuoteMeta(seg.suffix)
+		}
+
+		if seg.optional || seg.catchAll {
+			expr += "(?:/" + part + ")?"
+		} else {
+			expr += "/" + part
 		}
 	}
-	return nil
+
+	pattern, err := regexp.Compile("^" + expr + "/?$")
+	if err != nil {
+		return nil
+	}
+	return pattern
 }
 
-func matchRoute(path []byte, itype int) *RouteMatched {
-	var route *Route
-	var items []*Route
-	switch itype {
-	case 3:
-		items = wsRoutes
-	default:
-		items = routes
+// pageMethods returns GET, POST and the methods of the hooks a page type
+// overrides.
+func pageMethods(typ reflect.Type) []string {
+	methods := []string{"GET", "POST"}
+	for _, m := range httpMethods {
+		hook, ok := methodHooks[m]
+		if !ok || hook == "Get" || hook == "Post" {
+			continue
+		}
+		if overridesHook(typ, hook) {
+			methods = append(methods, m)
+		}
 	}
+	return methods
+}
+
+var pageType = reflect.TypeOf(Page{})
 
-	for _, route = range items {
-		if route.Pattern == nil {
-			// fix route
-			if bytes.HasSuffix(path, B_SLASH) {
-				path = bytes.TrimSuffix(path, B_SLASH)
+// overridesHook reports whether a page type has its own hook instead of
+// the no-op one of Page. A method promoted from an embedded type is an
+// <autogenerated> wrapper, its declaration is looked for in the embedded type.
+func overridesHook(typ reflect.Type, hook string) bool {
+	for typ.Kind() == reflect.Struct {
+		m, ok := reflect.PtrTo(typ).MethodByName(hook)
+		if !ok {
+			return false
+		}
+		if f := runtime.FuncForPC(m.Func.Pointer()); f != nil {
+			if file, _ := f.FileLine(f.Entry()); file != "<autogenerated>" {
+				return typ != pageType
 			}
-			if bytes.Equal(path, route.Rule) {
-				return &RouteMatched{ClassType: route.ClassType, Params: nil}
+		}
+
+		var next reflect.Type
+		for i := 0; i < typ.NumField() && next == nil; i++ {
+			field := typ.Field(i)
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
 			}
-		} else {
-			// regexp route
-			if matched := route.Pattern.FindAllSubmatch(path, -1); matched != nil {
-				params := make(map[string]string)
-				i := 0
-				for _, value := range route.Keys {
-					i++
-					params[value] = html.EscapeString(string(matched[0][i]))
-				}
-				return &RouteMatched{ClassType: route.ClassType, Params: params}
+			if _, ok := reflect.PtrTo(ft).MethodByName(hook); field.Anonymous && ok {
+				next = ft
 			}
 		}
+		if next == nil {
+			return typ != pageType
+		}
+		typ = next
+	}
+	return false
+}
+
+func (a *App) routeTableOf(itype int) *routeTable {
+	switch itype {
+	case 1:
+		return a.apiRoutes
+	case 2:
+		return a.upRoutes
+	case 3:
+		return a.wsRoutes
+	default:
+		return a.routes
 	}
+}
 
-	return nil
+func (a *App) matchRoute(path []byte, itype int) *RouteMatched {
+	return a.routeTableOf(itype).match(string(path))
 }
@@ -0,0 +1,143 @@
+package gos
+
+import (
+	"context"
+	"github.com/jiorry/libs/log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Shutdown stops the default app, see App.Shutdown.
+func Shutdown(ctx context.Context) error {
+	return defaultApp.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections, closes the websocket servers of
+// the app and waits for the in-flight requests until ctx is done.
+// Start returns after Shutdown finishes.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	if a.closing != nil {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closing = make(chan bool)
+	servers, listener := a.servers, a.listener
+	a.mu.Unlock()
+
+	defer close(a.closing)
+
+	for _, r := range a.wsRoutes.list {
+		if s := r.wsServer; s != nil {
+			s.Close()
+		}
+	}
+
+	var err error
+	for _, server := range servers {
+		if e := server.Shutdown(ctx); e != nil {
+			err = e
+		}
+	}
+	if listener != nil {
+		listener.Close()
+		err = a.waitInflight(ctx)
+	}
+
+	if err != nil {
+		log.App.Error("shutdown:", err)
+	} else {
+		log.App.Write("server is shut down")
+	}
+	return err
+}
+
+// serving keeps the running servers for Shutdown. l is the fcgi listener.
+// After Shutdown, the servers and l are closed, so they serve nothing.
+func (a *App) serving(l net.Listener, servers ...*http.Server) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closing != nil {
+		for _, server := range servers {
+			server.Close()
+		}
+		if l != nil {
+			l.Close()
+		}
+		return
+	}
+	a.servers = append(a.servers, servers...)
+	a.listener = l
+}
+
+// shuttingDown returns the channel closed when Shutdown finishes,
+// or nil if Shutdown is not called.
+func (a *App) shuttingDown() chan bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.closing
+}
+
+// handleSignals shuts the app down on SIGINT and SIGTERM, and reloads
+// the TLS certificate on SIGHUP when TLSCert is set.
+func (a *App) handleSignals() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	if a.Config.TLSCert != "" && !a.Config.UseFcgi {
+		signal.Notify(ch, syscall.SIGHUP)
+	}
+	quit := make(chan bool)
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if sig == syscall.SIGHUP {
+					a.reloadCert()
+					continue
+				}
+				log.App.Write("receive signal ", sig.String(), ", shutting down")
+				ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+				a.Shutdown(ctx)
+				cancel()
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(quit)
+	}
+}
+
+// trackInflight counts the running requests for servers without their own
+// graceful shutdown, like fcgi.Serve.
+func (a *App) trackInflight(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		a.inflight.Add(1)
+		defer a.inflight.Done()
+		h.ServeHTTP(rw, req)
+	})
+}
+
+func (a *App) waitInflight(ctx context.Context) error {
+	done := make(chan bool)
+	go func() {
+		a.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,207 @@
+package gos
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+)
+
+// templateCache keeps the parsed views of an app by view and layout.
+// The views are parsed once, in dev mode they are parsed again
+// when one of their files changes.
+type templateCache struct {
+	mu    sync.RWMutex
+	items map[string]*cachedTemplate
+	texts map[string]*template.Template // TextRender templates by name and source
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{items: make(map[string]*cachedTemplate), texts: make(map[string]*template.Template)}
+}
+
+// maxTextTemplates bounds the parsed TextRender sources kept by an app.
+const maxTextTemplates = 1000
+
+// textTemplate returns the parsed TextRender source.
+func (a *App) textTemplate(name, source string) (*template.Template, error) {
+	key := name + "\x00" + source
+
+	a.templates.mu.RLock()
+	tmpl, ok := a.templates.texts[key]
+	a.templates.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(a.funcs()).Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	a.templates.mu.Lock()
+	if len(a.templates.texts) >= maxTextTemplates {
+		a.templates.texts = make(map[string]*template.Template)
+	}
+	a.templates.texts[key] = tmpl
+	a.templates.mu.Unlock()
+	return tmpl, nil
+}
+
+type cachedTemplate struct {
+	fsys  fs.FS
+	view  View
+	set   *ViewSet
+	files map[string]string // template name => file
+	mtime map[string]time.Time
+}
+
+// changed reports whether a parsed file or partials folder has changed.
+func (c *cachedTemplate) changed() bool {
+	for name, t := range c.mtime {
+		info, err := fs.Stat(c.fsys, name)
+		if err != nil {
+			if !t.IsZero() {
+				return true
+			}
+			continue
+		}
+		if !info.ModTime().Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cachedTemplate) watch(name string) {
+	var t time.Time
+	if info, err := fs.Stat(c.fsys, name); err == nil {
+		t = info.ModTime()
+	}
+	c.mtime[name] = t
+}
+
+func (c *cachedTemplate) add(name, filename string) {
+	c.watch(filename)
+	c.files[name] = filename
+	c.set.Templates = append(c.set.Templates, ViewFile{name, filename})
+}
+
+// addPartials adds the templates of dir with the extension as partials/name.
+func (c *cachedTemplate) addPartials(dir, ext string) error {
+	c.watch(dir)
+	return fs.WalkDir(c.fsys, dir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if filename == dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if filename != dir {
+				c.watch(filename)
+			}
+			return nil
+		}
+		if !strings.HasSuffix(filename, ext) {
+			return nil
+		}
+		c.add("partials/"+strings.TrimSuffix(filename[len(dir)+1:], ext), filename)
+		return nil
+	})
+}
+
+// error returns err as a TemplateError of the file of the failing template.
+func (c *cachedTemplate) error(err error) *TemplateError {
+	filename := c.files[c.set.Name]
+	if perr, ok := err.(*fs.PathError); ok {
+		filename = perr.Path
+	} else if m := templateLineReg.FindStringSubmatch(err.Error()); m != nil {
+		if f, ok := c.files[m[1]]; ok {
+			filename = f
+		}
+	}
+	return &TemplateError{File: filename, Err: err}
+}
+
+func (c *cachedTemplate) execute(w io.Writer, data interface{}, funcs map[string]interface{}) error {
+	if err := c.view.Execute(w, data, funcs); err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// template returns the parsed view, executed by the layout when it is given.
+func (a *App) template(view *ThemeItem, layout string) (*cachedTemplate, error) {
+	key := view.GetPath() + "|" + layout
+
+	a.templates.mu.RLock()
+	c, ok := a.templates.items[key]
+	a.templates.mu.RUnlock()
+	if ok && (a.runMode() != "dev" || !c.changed()) {
+		return c, nil
+	}
+
+	c, err := a.parseTemplate(view, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	a.templates.mu.Lock()
+	a.templates.items[key] = c
+	a.templates.mu.Unlock()
+	return c, nil
+}
+
+// viewExt returns the extension of the view file, see RegisterViewEngine.
+func viewExt(fsys fs.FS, view *ThemeItem) string {
+	exts := viewExts()
+	for _, ext := range exts {
+		if _, err := fs.Stat(fsys, fsPath(view.GetPath()+ext)); err == nil {
+			return ext
+		}
+	}
+	return exts[0]
+}
+
+// parseTemplate parses the view with the partials of the template folder,
+// template/partials/* are available as {{template "partials/name" .}}
+// and the partials of a theme override the common ones.
+// The layout, e.g. "layouts/base", is a template of the same folder
+// declaring {{block "name" .}} sections which the view overrides
+// by {{define "name"}}.
+func (a *App) parseTemplate(view *ThemeItem, layout string) (*cachedTemplate, error) {
+	fsys := a.FS()
+	c := &cachedTemplate{
+		fsys:  fsys,
+		set:   &ViewSet{Name: view.Value, FS: fsys},
+		files: make(map[string]string),
+		mtime: make(map[string]time.Time)}
+
+	ext := viewExt(fsys, view)
+	if err := c.addPartials(fsPath(view.Folder+"/partials"), ext); err != nil {
+		return nil, err
+	}
+	if view.Theme != "" {
+		if err := c.addPartials(fsPath("themes/"+view.Theme+"/"+view.Folder+"/partials"), ext); err != nil {
+			return nil, err
+		}
+	}
+
+	if layout != "" {
+		item := &ThemeItem{view.Theme, view.Folder, layout, nil}
+		c.add(layout, fsPath(item.GetPath()+ext))
+		c.set.Name = layout
+	}
+	c.add(view.Value, fsPath(view.GetPath()+ext))
+
+	v, err := viewExtensions[ext].engine.Parse(c.set, a.funcs())
+	if err != nil {
+		return nil, c.error(err)
+	}
+	c.view = v
+	return c, nil
+}
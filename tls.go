@@ -0,0 +1,125 @@
+package gos
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/jiorry/libs/log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// serveTLS serves https on HttpsPort and plain http on l, which redirects
+// to https when HttpsRedirect is set.
+func (a *App) serveTLS(l net.Listener, handler http.Handler) error {
+	certs := &certLoader{certFile: a.Config.TLSCert, keyFile: a.Config.TLSKey}
+	if err := certs.load(); err != nil {
+		l.Close()
+		log.App.Error(err)
+		return err
+	}
+	a.mu.Lock()
+	a.certs = certs
+	a.mu.Unlock()
+
+	addr := fmt.Sprintf("%s:%d", a.Config.Addr, a.Config.HttpsPort)
+	tl, err := net.Listen("tcp", addr)
+	if err != nil {
+		l.Close()
+		log.App.Error(err)
+		return err
+	}
+
+	httpsServer := &http.Server{
+		Handler:   a.hsts(handler),
+		TLSConfig: &tls.Config{GetCertificate: certs.getCertificate}}
+
+	plain := handler
+	if a.Config.HttpsRedirect {
+		plain = a.applyMiddlewares(http.HandlerFunc(a.redirectToHttps))
+	}
+	httpServer := &http.Server{Handler: plain}
+	a.serving(nil, httpsServer, httpServer)
+
+	log.App.Write("server start at ", l.Addr().String(), " and https at ", addr)
+	errCh := make(chan error, 2)
+	go func() { errCh <- httpsServer.ServeTLS(tl, "", "") }()
+	go func() { errCh <- httpServer.Serve(l) }()
+
+	err = <-errCh
+	if a.shuttingDown() == nil {
+		// one of the servers failed, stop the other
+		httpsServer.Close()
+		httpServer.Close()
+	}
+	<-errCh
+	return err
+}
+
+func (a *App) redirectToHttps(rw http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if a.Config.HttpsPort != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(a.Config.HttpsPort))
+	}
+	http.Redirect(rw, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// hsts adds the Strict-Transport-Security header to https responses.
+func (a *App) hsts(h http.Handler) http.Handler {
+	if a.Config.HSTSMaxAge <= 0 {
+		return h
+	}
+	value := "max-age=" + strconv.Itoa(a.Config.HSTSMaxAge)
+	if a.Config.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil {
+			rw.Header().Set("Strict-Transport-Security", value)
+		}
+		h.ServeHTTP(rw, req)
+	})
+}
+
+func (a *App) reloadCert() {
+	a.mu.Lock()
+	certs := a.certs
+	a.mu.Unlock()
+	if certs == nil {
+		return
+	}
+	if err := certs.load(); err != nil {
+		log.App.Error("reload certificate:", err)
+		return
+	}
+	log.App.Write("certificate reloaded")
+}
+
+// certLoader keeps the certificate, it is reloaded from the files on SIGHUP.
+type certLoader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (c *certLoader) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
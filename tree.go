@@ -0,0 +1,271 @@
+package gos
+
+import (
+	"github.com/jiorry/libs/log"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Named constraints for typed route parameters, e.g. /product/:id<int>.
+// Any other text between the angle brackets is used as a regular expression.
+var routeParamTypes = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"word":  `\w+`,
+	"any":   `[^/]+`,
+}
+
+const defaultParamType = "word"
+
+var segmentReg = regexp.MustCompile(`^([^:*]*):(\w+)(?:<(.+)>)?(.*)$`)
+
+// routeTable keeps the registered routes in order and the tree used to match them.
+type routeTable struct {
+	list []*Route
+	tree *routeNode
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{list: make([]*Route, 0), tree: &routeNode{}}
+}
+
+func (t *routeTable) add(r *Route) {
+	t.list = append(t.list, r)
+	for _, segs := range expandOptional(r.segments) {
+		t.tree.insert(segs, r)
+	}
+}
+
+func (t *routeTable) match(path string) *RouteMatched {
+	values := make([]string, 0, 4)
+	leaf, values := t.tree.match(splitPath(path), values)
+	if leaf == nil {
+		return nil
+	}
+
+	var params map[string]string
+	if len(leaf.keys) > 0 {
+		params = make(map[string]string, len(leaf.keys))
+		for i, k := range leaf.keys {
+			params[k] = html.EscapeString(values[i])
+		}
+	}
+	return &RouteMatched{Route: leaf.route, ClassType: leaf.route.ClassType, Params: params}
+}
+
+type routeLeaf struct {
+	route *Route
+	keys  []string
+}
+
+// routeNode is one path segment of the routing tree.
+// Lookup walks one node per segment, trying static children first,
+// then parameter children and the catch-all child last.
+type routeNode struct {
+	static   map[string]*routeNode
+	params   []*routeNode
+	catchAll *routeNode
+
+	// parameter segment: prefix + :key<pattern> + suffix
+	key     string
+	prefix  string
+	suffix  string
+	typ     string
+	pattern *regexp.Regexp
+
+	leaf *routeLeaf
+}
+
+func (n *routeNode) insert(segs []ruleSegment, r *Route) {
+	keys := make([]string, 0)
+	for _, seg := range segs {
+		switch {
+		case seg.catchAll:
+			if n.catchAll == nil {
+				n.catchAll = &routeNode{key: seg.key}
+			}
+			n = n.catchAll
+		case seg.key != "":
+			n = n.paramChild(seg)
+		default:
+			if n.static == nil {
+				n.static = make(map[string]*routeNode)
+			}
+			child, ok := n.static[seg.static]
+			if !ok {
+				child = &routeNode{}
+				n.static[seg.static] = child
+			}
+			n = child
+			continue
+		}
+		keys = append(keys, seg.key)
+	}
+
+	if n.leaf != nil {
+		log.App.Alert("route " + string(r.Rule) + " is shadowed by " + string(n.leaf.route.Rule))
+		return
+	}
+	n.leaf = &routeLeaf{route: r, keys: keys}
+}
+
+func (n *routeNode) paramChild(seg ruleSegment) *routeNode {
+	for _, child := range n.params {
+		if child.key == seg.key && child.prefix == seg.prefix && child.suffix == seg.suffix && child.typ == seg.typ {
+			return child
+		}
+	}
+
+	child := &routeNode{key: seg.key, prefix: seg.prefix, suffix: seg.suffix, typ: seg.typ, pattern: seg.pattern}
+
+	// constrained parameters are tried before the default one
+	i := len(n.params)
+	if seg.typ != defaultParamType {
+		for i = 0; i < len(n.params); i++ {
+			if n.params[i].typ == defaultParamType {
+				break
+			}
+		}
+	}
+	n.params = append(n.params, nil)
+	copy(n.params[i+1:], n.params[i:])
+	n.params[i] = child
+	return child
+}
+
+func (n *routeNode) match(segs []string, values []string) (*routeLeaf, []string) {
+	if len(segs) == 0 {
+		if n.leaf != nil {
+			return n.leaf, values
+		}
+		if n.catchAll != nil && n.catchAll.leaf != nil {
+			return n.catchAll.leaf, append(values, "")
+		}
+		return nil, values
+	}
+
+	seg := segs[0]
+	if child, ok := n.static[seg]; ok {
+		if leaf, v := child.match(segs[1:], values); leaf != nil {
+			return leaf, v
+		}
+	}
+
+	for _, child := range n.params {
+		if len(seg) <= len(child.prefix)+len(child.suffix) ||
+			!strings.HasPrefix(seg, child.prefix) || !strings.HasSuffix(seg, child.suffix) {
+			continue
+		}
+		value := seg[len(child.prefix) : len(seg)-len(child.suffix)]
+		if !child.pattern.MatchString(value) {
+			continue
+		}
+		if leaf, v := child.match(segs[1:], append(values, value)); leaf != nil {
+			return leaf, v
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.leaf != nil {
+		return n.catchAll.leaf, append(values, strings.Join(segs, "/"))
+	}
+
+	return nil, values
+}
+
+// paramExpr returns the regular expression of a parameter type,
+// a named type of routeParamTypes or a regular expression.
+func paramExpr(typ string) string {
+	if expr, ok := routeParamTypes[typ]; ok {
+		return expr
+	}
+	return typ
+}
+
+// ruleSegment is a segment of a rule, parsed once when the route is added
+// to build the routing tree, the keys, the pattern and the urls of the route.
+type ruleSegment struct {
+	static   string
+	key      string
+	prefix   string
+	suffix   string
+	typ      string
+	pattern  *regexp.Regexp
+	catchAll bool
+	optional bool
+}
+
+func parseRule(rule string) []ruleSegment {
+	parts := splitPath(rule)
+	segs := make([]ruleSegment, len(parts))
+	for i, part := range parts {
+		s := &segs[i]
+		s.optional = strings.HasSuffix(part, "?")
+		part = strings.TrimSuffix(part, "?")
+
+		if strings.HasPrefix(part, "*") {
+			if i != len(parts)-1 {
+				panic("route " + rule + ": catch-all segment must be the last one")
+			}
+			s.key, s.catchAll = part[1:], true
+		} else if m := segmentReg.FindStringSubmatch(part); m != nil {
+			s.prefix, s.key, s.typ, s.suffix = m[1], m[2], m[3], m[4]
+			if s.typ == "" {
+				s.typ = defaultParamType
+			}
+			pattern, err := regexp.Compile("^(?:" + paramExpr(s.typ) + ")$")
+			if err != nil {
+				panic("route " + rule + ": " + err.Error())
+			}
+			s.pattern = pattern
+		} else {
+			s.static = part
+		}
+	}
+	return segs
+}
+
+// ruleKeys returns the parameter keys of the segments, nil for none.
+func ruleKeys(segs []ruleSegment) []string {
+	var keys []string
+	for _, seg := range segs {
+		if seg.key != "" {
+			keys = append(keys, seg.key)
+		}
+	}
+	return keys
+}
+
+// splitPath splits /a/b/ into [a b].
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+// expandOptional turns optional segments into every combination with
+// and without them, e.g. /list/:page<int>? registers both /list and
+// /list/:page<int>.
+func expandOptional(segs []ruleSegment) [][]ruleSegment {
+	result := [][]ruleSegment{{}}
+	for _, seg := range segs {
+		if !seg.optional {
+			for i := range result {
+				result[i] = append(result[i], seg)
+			}
+			continue
+		}
+
+		l := len(result)
+		for i := 0; i < l; i++ {
+			with := make([]ruleSegment, len(result[i]), len(result[i])+1)
+			copy(with, result[i])
+			result = append(result, append(with, seg))
+		}
+	}
+	return result
+}
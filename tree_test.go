@@ -0,0 +1,150 @@
+package gos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testRoute(rule string) *Route {
+	segs := parseRule(rule)
+	return &Route{Rule: []byte(rule), Keys: ruleKeys(segs), Pattern: rulePattern(segs), segments: segs}
+}
+
+func TestRouteTableMatch(t *testing.T) {
+	table := newRouteTable()
+	for _, rule := range []string{
+		"/",
+		"/users/new",
+		"/users/:id<int>",
+		"/users/:name",
+		"/users/:id<int>/edit",
+		"/a/:x/b",
+		"/a/static/c",
+		"/docs/:page/info",
+		"/docs/*rest",
+		"/blog/:year<uint>/:slug?",
+		"/v:ver<[0-9]+>.json",
+		"/search/:q<any>",
+	} {
+		table.add(testRoute(rule))
+	}
+
+	cases := []struct {
+		path   string
+		rule   string
+		params map[string]string
+	}{
+		{"/", "/", nil},
+		{"/users/new", "/users/new", nil},
+		{"/users/42", "/users/:id<int>", map[string]string{"id": "42"}},
+		{"/users/-1", "/users/:id<int>", map[string]string{"id": "-1"}},
+		{"/users/bob", "/users/:name", map[string]string{"name": "bob"}},
+		{"/users/42/edit", "/users/:id<int>/edit", map[string]string{"id": "42"}},
+		{"/users/bob/edit", "", nil},
+		{"/a/static/c", "/a/static/c", nil},
+		{"/a/static/b", "/a/:x/b", map[string]string{"x": "static"}},
+		{"/docs/intro/info", "/docs/:page/info", map[string]string{"page": "intro"}},
+		{"/docs/intro/more", "/docs/*rest", map[string]string{"rest": "intro/more"}},
+		{"/docs", "/docs/*rest", map[string]string{"rest": ""}},
+		{"/blog/2020", "/blog/:year<uint>/:slug?", map[string]string{"year": "2020"}},
+		{"/blog/2020/hello", "/blog/:year<uint>/:slug?", map[string]string{"year": "2020", "slug": "hello"}},
+		{"/blog/-1", "", nil},
+		{"/blog/2020/hello/x", "", nil},
+		{"/v12.json", "/v:ver<[0-9]+>.json", map[string]string{"ver": "12"}},
+		{"/v.json", "", nil},
+		{"/vx.json", "", nil},
+		{"/v1.xml", "", nil},
+		{"/search/a&b", "/search/:q<any>", map[string]string{"q": "a&amp;b"}},
+		{"/missing", "", nil},
+	}
+
+	for _, c := range cases {
+		m := table.match(c.path)
+		if m == nil {
+			if c.rule != "" {
+				t.Errorf("%s: no match, want %s", c.path, c.rule)
+			}
+			continue
+		}
+		if rule := string(m.Route.Rule); rule != c.rule {
+			t.Errorf("%s: matched %s, want %q", c.path, rule, c.rule)
+			continue
+		}
+		if !reflect.DeepEqual(m.Params, c.params) {
+			t.Errorf("%s: params %v, want %v", c.path, m.Params, c.params)
+		}
+	}
+}
+
+func TestRouteTableInvalidRule(t *testing.T) {
+	for _, rule := range []string{
+		"/files/*path/x",
+		"/users/:id<[0-9>",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", rule)
+				}
+			}()
+			newRouteTable().add(testRoute(rule))
+		}()
+	}
+}
+
+func TestRuleKeysAndPattern(t *testing.T) {
+	cases := []struct {
+		rule    string
+		keys    []string
+		pattern string
+	}{
+		{"/users/new", nil, ""},
+		{"/users/:id<int>", []string{"id"}, `^/users/(-?[0-9]+)/?$`},
+		{"/blog/:year<uint>/:slug?", []string{"year", "slug"}, `^/blog/([0-9]+)(?:/(\w+))?/?$`},
+		{"/v:ver<[0-9]+>.json", []string{"ver"}, `^/v([0-9]+)\.json/?$`},
+		{"/docs/*rest", []string{"rest"}, `^/docs(?:/(.*))?/?$`},
+	}
+
+	for _, c := range cases {
+		r := testRoute(c.rule)
+		if !reflect.DeepEqual(r.Keys, c.keys) {
+			t.Errorf("%s: keys %v, want %v", c.rule, r.Keys, c.keys)
+		}
+		pattern := ""
+		if r.Pattern != nil {
+			pattern = r.Pattern.String()
+		}
+		if pattern != c.pattern {
+			t.Errorf("%s: pattern %s, want %s", c.rule, pattern, c.pattern)
+		}
+	}
+}
+
+func TestRoutePath(t *testing.T) {
+	cases := []struct {
+		rule string
+		args []interface{}
+		path string
+		err  bool
+	}{
+		{"/users/:id<int>", []interface{}{"id", 42}, "/users/42", false},
+		{"/users/:id<int>", []interface{}{"id", "bob"}, "", true},
+		{"/users/:id<int>", nil, "", true},
+		{"/blog/:year<uint>/:slug?", []interface{}{"year", 2020}, "/blog/2020", false},
+		{"/v:ver<[0-9]+>.json", []interface{}{"ver", 2}, "/v2.json", false},
+		{"/docs/*rest", []interface{}{"rest", "a b/c"}, "/docs/a%20b/c", false},
+		{"/docs/*rest?", nil, "/docs", false},
+	}
+
+	for _, c := range cases {
+		r := testRoute(c.rule)
+		path, err := r.path("test", c.args)
+		if (err != nil) != c.err {
+			t.Errorf("%s %v: error %v", c.rule, c.args, err)
+			continue
+		}
+		if !c.err && path != c.path {
+			t.Errorf("%s %v: got %s, want %s", c.rule, c.args, path, c.path)
+		}
+	}
+}
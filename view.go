@@ -0,0 +1,172 @@
+package gos
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"sync"
+	texttemplate "text/template"
+)
+
+// ViewEngine parses the view files of the extensions it is registered for.
+// The parsed views are cached by the app and parsed again when the files
+// change in dev mode.
+type ViewEngine interface {
+	Parse(set *ViewSet, funcs map[string]interface{}) (View, error)
+}
+
+// View is a parsed view.
+type View interface {
+	// Execute runs the view, funcs are the functions bound to the request
+	// overriding the ones given to Parse.
+	Execute(w io.Writer, data interface{}, funcs map[string]interface{}) error
+}
+
+// ViewSet is the templates of a view, in parse order: the partials,
+// the layout and the view. Name is the template to execute.
+type ViewSet struct {
+	Name      string
+	Templates []ViewFile
+	FS        fs.FS
+}
+
+type ViewFile struct {
+	Name string // partials/header, layouts/base, index
+	File string // name in FS
+}
+
+type viewEngineItem struct {
+	name   string
+	engine ViewEngine
+}
+
+var (
+	// DefaultViewEngine is the engine whose extensions are looked up
+	// first, set by view_engine in the [app] config.
+	DefaultViewEngine = "html"
+
+	viewEngines    = make(map[string][]string) // name => extensions
+	viewExtensions = make(map[string]viewEngineItem)
+	viewExtOrder   []string
+)
+
+func init() {
+	RegisterViewEngine("html", &htmlEngine{}, ".htm")
+	RegisterViewEngine("text", &textEngine{}, ".tpl")
+}
+
+// RegisterViewEngine registers an engine for the file extensions, e.g.
+// RegisterViewEngine("amber", amberEngine, ".amber").
+// SetView("index") renders template/index with the first extension found,
+// trying the ones of DefaultViewEngine first.
+func RegisterViewEngine(name string, e ViewEngine, exts ...string) {
+	for _, ext := range exts {
+		if _, ok := viewExtensions[ext]; !ok {
+			viewExtOrder = append(viewExtOrder, ext)
+		}
+		viewExtensions[ext] = viewEngineItem{name, e}
+	}
+	viewEngines[name] = append(viewEngines[name], exts...)
+}
+
+// viewExts returns the extensions to look up, the default engine first.
+func viewExts() []string {
+	exts := make([]string, 0, len(viewExtOrder))
+	exts = append(exts, viewEngines[DefaultViewEngine]...)
+	for _, ext := range viewExtOrder {
+		if viewExtensions[ext].name != DefaultViewEngine {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// html/template
+type htmlEngine struct{}
+
+func (e *htmlEngine) Parse(set *ViewSet, funcs map[string]interface{}) (View, error) {
+	t := htmltemplate.New("").Funcs(funcs)
+	for _, f := range set.Templates {
+		src, err := fs.ReadFile(set.FS, f.File)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(f.Name).Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+	plain, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &htmlView{tmpl: t, name: set.Name, plain: plain}, nil
+}
+
+type htmlView struct {
+	tmpl  *htmltemplate.Template // never executed, so that it can be cloned
+	name  string
+	plain *htmltemplate.Template // executed without request funcs
+	pool  sync.Pool              // clones getting the request funcs
+}
+
+// Execute runs clones of the parsed template, html/template escapes
+// a template on its first execution only, so the clones are reused.
+// A pooled clone keeps the funcs of its last request until it is reused.
+func (v *htmlView) Execute(w io.Writer, data interface{}, funcs map[string]interface{}) error {
+	if funcs == nil {
+		return v.plain.ExecuteTemplate(w, v.name, data)
+	}
+
+	t, _ := v.pool.Get().(*htmltemplate.Template)
+	if t == nil {
+		var err error
+		if t, err = v.tmpl.Clone(); err != nil {
+			return err
+		}
+	}
+	t.Funcs(funcs)
+	err := t.ExecuteTemplate(w, v.name, data)
+	v.pool.Put(t)
+	return err
+}
+
+// text/template
+type textEngine struct{}
+
+func (e *textEngine) Parse(set *ViewSet, funcs map[string]interface{}) (View, error) {
+	t := texttemplate.New("").Funcs(funcs)
+	for _, f := range set.Templates {
+		src, err := fs.ReadFile(set.FS, f.File)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(f.Name).Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+	return &textView{tmpl: t, name: set.Name}, nil
+}
+
+type textView struct {
+	tmpl *texttemplate.Template
+	name string
+	pool sync.Pool // clones getting the request funcs
+}
+
+func (v *textView) Execute(w io.Writer, data interface{}, funcs map[string]interface{}) error {
+	if funcs == nil {
+		return v.tmpl.ExecuteTemplate(w, v.name, data)
+	}
+
+	t, _ := v.pool.Get().(*texttemplate.Template)
+	if t == nil {
+		var err error
+		if t, err = v.tmpl.Clone(); err != nil {
+			return err
+		}
+	}
+	t.Funcs(funcs)
+	err := t.ExecuteTemplate(w, v.name, data)
+	v.pool.Put(t)
+	return err
+}
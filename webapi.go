@@ -37,7 +37,7 @@ func (w *WebApi) Init() {}
 func (w *WebApi) Reply(data interface{}, err error) {
 	w.Ctx.ResponseWriter.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		w.Ctx.WriteString(NewError(0, err).Json())
+		w.Ctx.WriteString(w.Ctx.NewError(0, err).Json())
 		return
 	}
 
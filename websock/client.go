@@ -1,6 +1,7 @@
 package websock
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -52,8 +53,9 @@ func (c *Client) Send(msg *Message) {
 	}
 }
 
+// Done closes the connection, the client leaves its server.
 func (c *Client) Done() {
-	c.doneCh <- true
+	c.ws.Close()
 }
 
 // Listen Write and Read request via chanel
@@ -73,10 +75,9 @@ func (c *Client) listenWrite() {
 			fmt.Println("Send:", msg)
 			websocket.JSON.Send(c.ws, msg)
 
-		// receive done request
+		// the connection is closed, see listenRead
 		case <-c.doneCh:
 			c.server.Del(c)
-			c.doneCh <- true // for listenRead method
 			return
 		}
 	}
@@ -86,27 +87,25 @@ func (c *Client) listenWrite() {
 func (c *Client) listenRead() {
 	fmt.Println("Listening read from client")
 	for {
-		select {
-
-		// receive done request
-		case <-c.doneCh:
-			c.server.Del(c)
-			c.doneCh <- true // for listenWrite method
-			return
-
-		// read data from websocket connection
+		var msg Message
+		err := websocket.JSON.Receive(c.ws, &msg)
+		switch err.(type) {
+		case nil:
+			// c.server.Send(c, &msg)
+			fmt.Println("receive: ", msg)
+			c.control.Receive(c, &msg)
+
+		// a bad message
+		case *json.SyntaxError, *json.UnmarshalTypeError:
+			c.server.Err(err)
+
+		// the connection is closed
 		default:
-			var msg Message
-			err := websocket.JSON.Receive(c.ws, &msg)
-			if err == io.EOF {
-				c.doneCh <- true
-			} else if err != nil {
+			if err != io.EOF {
 				c.server.Err(err)
-			} else {
-				// c.server.Send(c, &msg)
-				fmt.Println("receive: ", msg)
-				c.control.Receive(c, &msg)
 			}
+			c.doneCh <- true // for listenWrite method
+			return
 		}
 	}
 }
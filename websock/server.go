@@ -2,6 +2,7 @@ package websock
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
 var pool = make(map[string]*Server, 0)
@@ -19,6 +20,8 @@ type Server struct {
 	sendCh  chan *SendMessages
 	doneCh  chan bool
 	errCh   chan error
+	closed  chan bool // closed when the server stops
+	count   int64
 }
 
 func GetServer(name string) *Server {
@@ -28,48 +31,85 @@ func GetServer(name string) *Server {
 	return nil
 }
 
-// Create new chat server.
+// NewServer creates a server kept in the pool of GetServer.
 func NewServer(name string) *Server {
+	pool[name] = New()
+	return pool[name]
+}
+
+// New creates a server which is not kept in the pool.
+func New() *Server {
 	clients := make(map[int64]*Client)
 	addCh := make(chan *Client)
 	delCh := make(chan *Client)
 	sendCh := make(chan *SendMessages)
 	doneCh := make(chan bool)
 	errCh := make(chan error)
+	closed := make(chan bool)
 
-	pool[name] = &Server{
+	return &Server{
 		clients,
 		addCh,
 		delCh,
 		sendCh,
 		doneCh,
 		errCh,
+		closed,
+		0,
 	}
-	return pool[name]
 }
 
+// Add, Del, Send and Err do not block once the server is closed.
 func (s *Server) Add(c *Client) {
-	s.addCh <- c
+	select {
+	case s.addCh <- c:
+	case <-s.closed:
+		c.ws.Close()
+	}
 }
 
 func (s *Server) Del(c *Client) {
-	s.delCh <- c
+	select {
+	case s.delCh <- c:
+	case <-s.closed:
+	}
 }
 
+// ClientCount returns the number of connected clients.
+func (s *Server) ClientCount() int {
+	return int(atomic.LoadInt64(&s.count))
+}
+
+// Done stops the server, see Close.
 func (s *Server) Done() {
-	s.doneCh <- true
+	s.Close()
+}
+
+// Close closes the connections of the clients and stops the server.
+func (s *Server) Close() {
+	select {
+	case s.doneCh <- true:
+		<-s.closed
+	case <-s.closed:
+	}
 }
 
 func (s *Server) Err(err error) {
-	s.errCh <- err
+	select {
+	case s.errCh <- err:
+	case <-s.closed:
+	}
 }
 
 func (s *Server) Send(c *Client, m *Message) {
-	s.sendCh <- &SendMessages{[]*Client{c}, []*Message{m}}
+	s.SendM([]*Client{c}, []*Message{m})
 }
 
 func (s *Server) SendM(c []*Client, m []*Message) {
-	s.sendCh <- &SendMessages{c, m}
+	select {
+	case s.sendCh <- &SendMessages{c, m}:
+	case <-s.closed:
+	}
 }
 
 func (s *Server) send(sm *SendMessages) {
@@ -92,6 +132,7 @@ func (s *Server) Start() {
 		case c := <-s.addCh:
 			fmt.Println("Added new client")
 			s.clients[c.id] = c
+			atomic.StoreInt64(&s.count, int64(len(s.clients)))
 			// log.Println("Now", len(s.clients), "clients connected.")
 			// s.sendPastMessages(c)
 
@@ -99,6 +140,7 @@ func (s *Server) Start() {
 		case c := <-s.delCh:
 			fmt.Println("Delete client")
 			delete(s.clients, c.id)
+			atomic.StoreInt64(&s.count, int64(len(s.clients)))
 
 		case smsg := <-s.sendCh:
 			fmt.Println("Send msg:", smsg)
@@ -108,6 +150,13 @@ func (s *Server) Start() {
 			fmt.Println("Error:", err)
 
 		case <-s.doneCh:
+			for _, c := range s.clients {
+				c.ws.Close()
+			}
+			s.clients = make(map[int64]*Client)
+			atomic.StoreInt64(&s.count, 0)
+			// the clients leaving after it do not wait for the loop
+			close(s.closed)
 			return
 		}
 	}
@@ -4,10 +4,16 @@ import (
 	"code.google.com/p/go.net/websocket"
 )
 
+// IContext is the request context of the websocket, implemented by gos.Context.
+type IContext interface {
+	RouterParam(key string) string
+}
+
 type WebSock struct {
 	Ws      *websocket.Conn
 	Control IControl
 	Server  *Server
+	Ctx     IContext
 }
 
 func (w *WebSock) Prepare(ws *websocket.Conn, control IControl, s *Server) {
@@ -16,13 +22,17 @@ func (w *WebSock) Prepare(ws *websocket.Conn, control IControl, s *Server) {
 	w.Server = s
 }
 
+func (w *WebSock) SetContext(ctx IContext) {
+	w.Ctx = ctx
+}
+
 func (w *WebSock) Init() {}
 
 func (w *WebSock) Listen() {
 	defer func() {
 		err := w.Ws.Close()
 		if err != nil {
-			w.Server.errCh <- err
+			w.Server.Err(err)
 		}
 	}()
 